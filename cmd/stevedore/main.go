@@ -1,24 +1,51 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"runtime"
 	"sort"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/jameswoolfenden/stevedore/internal/auth"
+	"github.com/jameswoolfenden/stevedore/internal/ci"
 	"github.com/jameswoolfenden/stevedore/internal/config"
 	"github.com/jameswoolfenden/stevedore/internal/dockerfile"
 	"github.com/jameswoolfenden/stevedore/internal/git"
+	"github.com/jameswoolfenden/stevedore/internal/registry"
+	"github.com/jameswoolfenden/stevedore/internal/report"
 	"github.com/jameswoolfenden/stevedore/src/version"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
 	"moul.io/banner"
 )
 
+// Exit codes used by the check and outdated commands
+const (
+	exitMissing  = 2
+	exitStale    = 3
+	exitOutdated = 1
+)
+
+// Output formats for reports
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
 func main() {
-	fmt.Println(banner.Inline("stevedore"))
-	fmt.Println("version:", version.Version)
+	// the banner goes to stderr so diffs and reports on stdout can be piped
+	fmt.Fprintln(os.Stderr, banner.Inline("stevedore"))
+	fmt.Fprintln(os.Stderr, "version:", version.Version)
 
 	// Initialize configuration
 	cfg := config.NewConfig()
@@ -29,7 +56,36 @@ func main() {
 
 	app := &cli.App{
 		EnableBashCompletion: true,
-		Flags:                []cli.Flag{},
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "config",
+				Usage: "Config file, defaults to the nearest " + config.ProjectFileName,
+			},
+			&cli.StringFlag{
+				Name:  "log-level",
+				Usage: "Log level: trace, debug, info, warn or error",
+			},
+			&cli.StringFlag{
+				Name:  "log-format",
+				Usage: "Log format: console or json",
+			},
+			&cli.DurationFlag{
+				Name:  "http-timeout",
+				Usage: "Timeout for registry requests",
+				Value: cfg.HTTPTimeout,
+			},
+			&cli.BoolFlag{
+				Name:  "cache",
+				Usage: "Cache registry manifests and config blobs in the user cache directory",
+			},
+			&cli.BoolFlag{
+				Name:  "offline",
+				Usage: "Answer registry lookups from the cache only",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			return configure(c, cfg, ".")
+		},
 		Commands: []*cli.Command{
 			{
 				Name:      "version",
@@ -46,38 +102,121 @@ func main() {
 				Aliases:   []string{"l"},
 				Usage:     "Updates Dockerfiles labels",
 				UsageText: "stevedore label [options]",
+				Before: func(c *cli.Context) error {
+					return configureCommand(c, cfg)
+				},
 				Action: func(c *cli.Context) error {
 					return runLabel(c, cfg)
 				},
-				Flags: []cli.Flag{
+				Flags: append(scanFlags(),
 					&cli.StringFlag{
-						Name:     "file",
-						Aliases:  []string{"f"},
-						Usage:    "Dockerfile to parse",
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "Directory to write updated Dockerfiles to, keeping their paths relative to the scanned directory (default: \".\")",
 						Category: "files",
 					},
-					&cli.StringFlag{
-						Name:     "directory",
-						Aliases:  []string{"d"},
-						Usage:    "Directory to scan for Dockerfiles",
-						Value:    ".",
+					&cli.BoolFlag{
+						Name:     "in-place",
+						Usage:    "Write each updated Dockerfile back to where it was read from",
 						Category: "files",
 					},
-					&cli.StringFlag{
-						Name:     "output",
-						Aliases:  []string{"o"},
-						Usage:    "Destination for updated Dockerfiles",
-						Value:    ".",
+					&cli.BoolFlag{
+						Name:     "dry-run",
+						Aliases:  []string{"diff"},
+						Usage:    "Print a diff of the changes instead of writing files, failing if any file would change",
 						Category: "files",
 					},
-					&cli.StringFlag{
-						Name:     "author",
-						Aliases:  []string{"a"},
-						Usage:    "Override for author name",
-						Value:    "",
+					&cli.BoolFlag{
+						Name:     "pin-digests",
+						Usage:    "Rewrite each FROM to image:tag@sha256:... and record the digest",
 						Category: "metadata",
 					},
+				),
+			},
+			{
+				Name:      "check",
+				Aliases:   []string{"c"},
+				Usage:     "Checks Dockerfiles carry the required labels",
+				UsageText: "stevedore check [options]",
+				Before: func(c *cli.Context) error {
+					return configureCommand(c, cfg)
 				},
+				Action: func(c *cli.Context) error {
+					return runCheck(c, cfg)
+				},
+				Flags: append(scanFlags(),
+					&cli.StringSliceFlag{
+						Name:     "require",
+						Aliases:  []string{"r"},
+						Usage:    "Label keys that must be present and non-empty, defaults to the labels stevedore writes",
+						Category: "metadata",
+					},
+				),
+			},
+			{
+				Name:      "inspect",
+				Aliases:   []string{"i"},
+				Usage:     "Lists the labels Dockerfiles declare, with build arguments expanded",
+				UsageText: "stevedore inspect [options]",
+				Before: func(c *cli.Context) error {
+					return configureCommand(c, cfg)
+				},
+				Action: func(c *cli.Context) error {
+					return runInspect(c, cfg)
+				},
+				Flags: append(fileFlags(),
+					platformFlag(),
+					&cli.StringSliceFlag{
+						Name:     "build-arg",
+						Usage:    "Build argument to expand labels with, as KEY=VALUE, or KEY to take the value from the environment",
+						Category: "metadata",
+					},
+					&cli.BoolFlag{
+						Name:     "parent",
+						Aliases:  []string{"p"},
+						Usage:    "Include the labels of each stage's base image, read from its registry",
+						Category: "metadata",
+					},
+					&cli.StringFlag{
+						Name:     "format",
+						Usage:    "Output format: table, json or yaml",
+						Value:    formatTable,
+						Category: "output",
+					},
+				),
+			},
+			{
+				Name:      "outdated",
+				Aliases:   []string{"o"},
+				Usage:     "Reports base images whose pinned digest has moved",
+				UsageText: "stevedore outdated [options]",
+				Before: func(c *cli.Context) error {
+					return configureCommand(c, cfg)
+				},
+				Action: func(c *cli.Context) error {
+					return runOutdated(c, cfg)
+				},
+				Flags: append(fileFlags(),
+					platformFlag(),
+					&cli.StringFlag{
+						Name:     "format",
+						Usage:    "Output format: table or json",
+						Value:    formatTable,
+						Category: "output",
+					},
+					&cli.BoolFlag{
+						Name:     "update",
+						Aliases:  []string{"u"},
+						Usage:    "Rewrite outdated digests in place",
+						Category: "files",
+					},
+					&cli.BoolFlag{
+						Name:     "dry-run",
+						Aliases:  []string{"diff"},
+						Usage:    "With --update, print a diff of the changes instead of writing files",
+						Category: "files",
+					},
+				),
 			},
 		},
 		Name:     "stevedore",
@@ -95,45 +234,623 @@ func main() {
 	}
 }
 
+// configure layers the configuration: defaults, then the config file, then STEVEDORE_* environment
+// variables, then global flags, failing fast on invalid settings. The config file is --config, or
+// else the one nearest dir, and its project settings are kept alongside.
+func configure(c *cli.Context, cfg *config.Config, dir string) error {
+	project, err := findProject(c, dir)
+	if err != nil {
+		return err
+	}
+
+	*cfg = *config.NewConfig()
+	cfg.Project = project
+
+	if project.Path != "" {
+		if err := cfg.LoadFile(project.Path); err != nil {
+			return err
+		}
+	}
+
+	if err := cfg.LoadEnv(); err != nil {
+		return err
+	}
+
+	if c.IsSet("log-level") {
+		cfg.LogLevel = c.String("log-level")
+	}
+
+	if c.IsSet("log-format") {
+		cfg.LogFormat = c.String("log-format")
+	}
+
+	if c.IsSet("http-timeout") {
+		cfg.HTTPTimeout = c.Duration("http-timeout")
+	}
+
+	if c.IsSet("cache") {
+		cfg.Cache = c.Bool("cache")
+	}
+
+	if c.IsSet("offline") {
+		cfg.Offline = c.Bool("offline")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return cfg.SetupLogging()
+}
+
+// configureCommand layers the configuration again from the config file for the scanned path, as
+// only now are the scan flags known, then applies the flags of commands that override it
+func configureCommand(c *cli.Context, cfg *config.Config) error {
+	if err := configure(c, cfg, scanTarget(c)); err != nil {
+		return err
+	}
+
+	if c.IsSet("author") {
+		cfg.DefaultAuthor = c.String("author")
+	}
+
+	if c.IsSet("output") {
+		cfg.Output = c.String("output")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return nil
+}
+
+// fileFlags select the Dockerfiles and stages a command works on
+func fileFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     "file",
+			Aliases:  []string{"f"},
+			Usage:    "Dockerfile to parse",
+			Category: "files",
+		},
+		&cli.StringFlag{
+			Name:     "directory",
+			Aliases:  []string{"d"},
+			Usage:    "Directory to scan for Dockerfiles",
+			Value:    ".",
+			Category: "files",
+		},
+		&cli.StringSliceFlag{
+			Name:     "stages",
+			Aliases:  []string{"s"},
+			Usage:    "Build stages to label, by name or index, \"final\" for the last stage or \"all\"",
+			Value:    cli.NewStringSlice("all"),
+			Category: "files",
+		},
+		&cli.IntFlag{
+			Name:     "jobs",
+			Aliases:  []string{"j"},
+			Usage:    "Number of Dockerfiles to process at once",
+			Value:    runtime.NumCPU(),
+			Category: "files",
+		},
+		&cli.BoolFlag{
+			Name:     "fail-fast",
+			Usage:    "Stop at the first Dockerfile that fails instead of reporting every failure at the end",
+			Category: "files",
+		},
+		&cli.StringSliceFlag{
+			Name:     "include",
+			Usage:    "Name patterns of the files to scan, replacing Dockerfile, Dockerfile.*, *.Dockerfile, *.dockerfile, Containerfile and Containerfile.*",
+			Category: "files",
+		},
+		&cli.StringSliceFlag{
+			Name:     "exclude",
+			Usage:    "Name patterns of files and directories to skip, as well as .git, node_modules, vendor, Markdown, *.dockerignore and backup files",
+			Category: "files",
+		},
+		&cli.IntFlag{
+			Name:     "max-depth",
+			Usage:    "How many directories deep to scan, 0 for no limit",
+			Category: "files",
+		},
+		&cli.BoolFlag{
+			Name:     "no-ignore",
+			Usage:    "Scan paths excluded by .gitignore and .dockerignore files",
+			Category: "files",
+		},
+	}
+}
+
+// platformFlag selects the platform read from multi-arch images
+func platformFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:     "platform",
+		Usage:    "Platform to resolve multi-arch base images for, as os/arch[/variant]",
+		Category: "metadata",
+	}
+}
+
+// scanFlags are the flags shared by commands that scan Dockerfiles and write or check labels
+func scanFlags() []cli.Flag {
+	return append(fileFlags(),
+		&cli.StringFlag{
+			Name:     "author",
+			Aliases:  []string{"a"},
+			Usage:    "Override for author name",
+			Value:    "",
+			Category: "metadata",
+		},
+		&cli.StringFlag{
+			Name:     "schema",
+			Usage:    "Label keys to write: legacy, oci (org.opencontainers.image.*) or both",
+			Value:    string(dockerfile.SchemaLegacy),
+			Category: "metadata",
+		},
+		&cli.StringFlag{
+			Name:     "licenses",
+			Usage:    "SPDX license expression for org.opencontainers.image.licenses",
+			Category: "metadata",
+		},
+		&cli.BoolFlag{
+			Name:     "inherit",
+			Aliases:  []string{"i"},
+			Usage:    "Record each base image, its digest and the layers labelled upstream",
+			Category: "metadata",
+		},
+		&cli.StringFlag{
+			Name:     "remote",
+			Usage:    "Git remote to read the repository's organisation, name and URL from (default: origin, else the first remote)",
+			Category: "metadata",
+		},
+		&cli.BoolFlag{
+			Name:     "blame",
+			Usage:    "Record who introduced each stage's FROM and who last changed the stage, from git blame",
+			Category: "metadata",
+		},
+		platformFlag(),
+		&cli.StringFlag{
+			Name:     "report",
+			Usage:    "Write a report of every Dockerfile processed to this file, or - for stdout",
+			Category: "output",
+		},
+		&cli.StringFlag{
+			Name:     "report-format",
+			Usage:    "Report format: json, or sarif for check findings (default: sarif for .sarif files, otherwise json)",
+			Category: "output",
+		},
+	)
+}
+
 // runLabel executes the label command
 func runLabel(c *cli.Context, cfg *config.Config) error {
-	// Get flags
-	file := c.String("file")
-	directory := c.String("directory")
-	output := c.String("output")
-	author := c.String("author")
+	if c.Bool("in-place") && c.IsSet("output") {
+		return fmt.Errorf("--in-place cannot be combined with --output")
+	}
 
-	// Override config with author if provided
-	if author != "" {
-		cfg.DefaultAuthor = author
+	reportFormat, err := reportFormat(c, false)
+	if err != nil {
+		return err
+	}
+
+	parser, err := newParser(c, cfg)
+	if err != nil {
+		return err
 	}
 
-	// Initialize services
-	authService := auth.NewDockerAuth()
+	parser.Output = cfg.Output
+	parser.InPlace = c.Bool("in-place")
+	parser.DryRun = c.Bool("dry-run")
+
+	// Execute parsing
+	err = parser.ParseAll()
+
+	if reportErr := writeReport(c, reportFormat, "label", parser.Reports()); reportErr != nil {
+		return reportErr
+	}
+
+	if err != nil {
+		if errors.Is(err, dockerfile.ErrChangesPending) {
+			return cli.Exit(err.Error(), 1)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// reportFormat validates the report options before any file is touched. SARIF describes
+// findings, so only the check command writes it.
+func reportFormat(c *cli.Context, sarif bool) (string, error) {
+	if !c.IsSet("report") {
+		return "", nil
+	}
+
+	format, err := report.Format(c.String("report-format"), c.String("report"))
+	if err != nil {
+		return "", err
+	}
+
+	if format == report.FormatSARIF && !sarif {
+		return "", fmt.Errorf("SARIF reports are only written by the check command")
+	}
+
+	return format, nil
+}
+
+// writeReport writes the report of a run to the file given by --report, when there is one
+func writeReport(c *cli.Context, format, command string, files []dockerfile.FileReport) error {
+	if format == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+
+	var err error
+	if format == report.FormatSARIF {
+		err = report.WriteSARIF(&buf, version.Version, files)
+	} else {
+		err = report.WriteJSON(&buf, version.Version, command, files)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	path := c.String("report")
+	if path == "-" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	//#nosec
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write report %s: %w", path, err)
+	}
+
+	log.Info().Msgf("report written to %s", path)
+
+	return nil
+}
+
+// runCheck executes the check command, exiting 2 when labels are missing and 3 when they are stale
+func runCheck(c *cli.Context, cfg *config.Config) error {
+	reportFormat, err := reportFormat(c, true)
+	if err != nil {
+		return err
+	}
+
+	parser, err := newParser(c, cfg)
+	if err != nil {
+		return err
+	}
+
+	findings, err := parser.CheckAll(c.StringSlice("require"))
+
+	if reportErr := writeReport(c, reportFormat, "check", parser.Reports()); reportErr != nil {
+		return reportErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	exitCode := 0
+
+	for _, finding := range findings {
+		fmt.Fprintln(parser.Out, finding.String())
+
+		switch finding.Kind {
+		case dockerfile.FindingMissing:
+			exitCode = exitMissing
+		case dockerfile.FindingStale:
+			if exitCode == 0 {
+				exitCode = exitStale
+			}
+		}
+	}
+
+	if exitCode != 0 {
+		return cli.Exit(fmt.Sprintf("%d label problems found", len(findings)), exitCode)
+	}
+
+	return nil
+}
+
+// runInspect executes the inspect command, printing the labels each stage declares
+func runInspect(c *cli.Context, cfg *config.Config) error {
+	format := c.String("format")
+	if format != formatTable && format != formatJSON && format != formatYAML {
+		return fmt.Errorf("unknown format %q, expected table, json or yaml", format)
+	}
+
+	buildArgs, err := parseBuildArgs(c.StringSlice("build-arg"))
+	if err != nil {
+		return err
+	}
+
+	parser, err := newParser(c, cfg)
+	if err != nil {
+		return err
+	}
+
+	stages, err := parser.InspectAll(buildArgs, c.Bool("parent"))
+	if err != nil {
+		return err
+	}
+
+	if stages == nil {
+		stages = []dockerfile.InspectedStage{}
+	}
+
+	switch format {
+	case formatJSON:
+		return writeJSON(parser.Out, stages)
+	case formatYAML:
+		return writeYAML(parser.Out, stages)
+	default:
+		return writeLabelTable(parser.Out, stages)
+	}
+}
+
+// parseBuildArgs reads --build-arg values the way docker build does: KEY=VALUE sets a value and
+// a bare KEY takes it from the environment, if it is set there
+func parseBuildArgs(values []string) (map[string]string, error) {
+	buildArgs := make(map[string]string, len(values))
+
+	for _, value := range values {
+		key, arg, ok := strings.Cut(value, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid build argument %q, expected KEY=VALUE", value)
+		}
+
+		if !ok {
+			if arg, ok = os.LookupEnv(key); !ok {
+				continue
+			}
+		}
+
+		buildArgs[key] = arg
+	}
+
+	return buildArgs, nil
+}
+
+// writeLabelTable prints one row per label, declared labels with the line that sets them and
+// parent labels with the image they come from
+func writeLabelTable(out io.Writer, stages []dockerfile.InspectedStage) error {
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "FILE\tSTAGE\tKEY\tVALUE\tSOURCE")
+
+	for _, stage := range stages {
+		for _, label := range stage.Labels {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\tline %d\n", stage.Path, stage.Stage, label.Key, label.Value, label.Line)
+		}
+
+		keys := make([]string, 0, len(stage.Parent))
+		for key := range stage.Parent {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", stage.Path, stage.Stage, key, stage.Parent[key], stage.BaseImage)
+		}
+	}
+
+	return table.Flush()
+}
+
+// writeYAML writes a value as YAML
+func writeYAML(out io.Writer, value interface{}) error {
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
+
+// runOutdated executes the outdated command, exiting 1 when pins have moved and were not updated
+func runOutdated(c *cli.Context, cfg *config.Config) error {
+	format := c.String("format")
+	if format != formatTable && format != formatJSON {
+		return fmt.Errorf("unknown format %q, expected table or json", format)
+	}
+
+	parser, err := newParser(c, cfg)
+	if err != nil {
+		return err
+	}
+
+	parser.DryRun = c.Bool("dry-run")
+
+	pins, err := parser.OutdatedAll(c.Bool("update"))
+	if err != nil && !errors.Is(err, dockerfile.ErrChangesPending) {
+		return err
+	}
+
+	if format == formatJSON {
+		if pins == nil {
+			pins = []dockerfile.Pin{}
+		}
+
+		err = writeJSON(parser.Out, pins)
+	} else {
+		err = writePinTable(parser.Out, pins)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	outdated := 0
+	for _, pin := range pins {
+		if pin.IsOutdated() {
+			outdated++
+		}
+	}
+
+	if outdated > 0 && (!c.Bool("update") || parser.DryRun) {
+		return cli.Exit(fmt.Sprintf("%d base images are outdated", outdated), exitOutdated)
+	}
+
+	return nil
+}
+
+// writePinTable prints pins as an aligned table
+func writePinTable(out io.Writer, pins []dockerfile.Pin) error {
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "FILE\tSTAGE\tIMAGE\tPINNED\tCURRENT")
+
+	for _, pin := range pins {
+		current := pin.Current
+		switch {
+		case pin.Error != "":
+			current = "error: " + pin.Error
+		case !pin.IsOutdated():
+			current = "up to date"
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", pin.Path, pin.Stage, pin.Image, pin.Pinned, current)
+	}
+
+	return table.Flush()
+}
+
+// writeJSON prints a value as indented JSON
+func writeJSON(out io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(value)
+}
+
+// configureRegistry applies the cache and platform settings for registry lookups
+func configureRegistry(c *cli.Context, cfg *config.Config, labeler *dockerfile.Labeller) error {
+	if cfg.Cache || cfg.Offline {
+		dir, err := registry.DefaultCacheDir()
+		if err != nil {
+			return err
+		}
+
+		labeler.UseCache(registry.NewCache(dir), cfg.Offline)
+	}
+
+	if c.IsSet("platform") {
+		platform, err := registry.ParsePlatform(c.String("platform"))
+		if err != nil {
+			return err
+		}
+
+		labeler.SetPlatform(platform)
+	}
+
+	return nil
+}
+
+// findProject loads the config file given with --config, or else finds the one nearest dir
+func findProject(c *cli.Context, dir string) (*config.Project, error) {
+	if path := c.String("config"); path != "" {
+		return config.LoadProject(path)
+	}
+
+	return config.FindProject(dir)
+}
+
+// scanTarget is the file or directory a command scans
+func scanTarget(c *cli.Context) string {
+	if file := c.String("file"); file != "" {
+		return file
+	}
+
+	return c.String("directory")
+}
+
+// newParser sets up the services and parser shared by the commands that scan Dockerfiles
+func newParser(c *cli.Context, cfg *config.Config) (*dockerfile.Parser, error) {
+	// Initialize services, using any registry logins from the Docker config
+	authService, err := auth.NewConfigAuth(&http.Client{Timeout: cfg.HTTPTimeout})
+	if err != nil {
+		log.Warn().Err(err).Msg("ignoring docker credentials, using anonymous registry access")
+		authService = auth.NewDockerAuthWithTimeout(cfg.HTTPTimeout)
+	}
 
 	// Initialize git service (may be nil if not in a git repo)
 	var gitService git.Service
-	var err error
 
-	workDir := directory
-	if file != "" {
-		workDir = file
+	workDir := scanTarget(c)
+	project := cfg.Project
+
+	if project.Path != "" {
+		log.Info().Msgf("using project file: %s", project.Path)
 	}
 
-	gitService, err = git.NewGitService(workDir)
+	schemaName := c.String("schema")
+	if !c.IsSet("schema") && project.Schema != "" {
+		schemaName = project.Schema
+	}
+
+	schema, err := dockerfile.ParseSchema(schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	licenses := c.String("licenses")
+	if licenses == "" {
+		licenses = project.Licenses
+	}
+
+	gitService, err = git.NewGitServiceWithRemote(workDir, c.String("remote"))
 	if err != nil {
+		// a remote asked for by name must be found
+		if c.IsSet("remote") {
+			return nil, err
+		}
+
 		log.Warn().Err(err).Msg("git service unavailable, will skip git metadata")
 		gitService = nil
 	}
 
 	// Create labeler and parser
 	labeler := dockerfile.NewLabeler(gitService, authService)
+	labeler.SetHTTPTimeout(cfg.HTTPTimeout)
+	labeler.Stages = c.StringSlice("stages")
+	labeler.Schema = schema
+	labeler.Licenses = licenses
+	labeler.Project = project
+	labeler.Inherit = c.Bool("inherit")
+	labeler.PinDigests = c.Bool("pin-digests")
+	labeler.Blame = c.Bool("blame")
+
+	if info, ok := ci.Detect(); ok {
+		log.Debug().Msgf("running under %s", info.Provider)
+		labeler.CI = &info
+	}
+
+	if err := configureRegistry(c, cfg, labeler); err != nil {
+		return nil, err
+	}
+
 	parser := dockerfile.NewParser(labeler)
-	parser.File = file
-	parser.Directory = directory
-	parser.Output = output
+	parser.File = c.String("file")
+	parser.Directory = c.String("directory")
+	parser.Jobs = c.Int("jobs")
+	parser.FailFast = c.Bool("fail-fast")
+	parser.Include = project.Include
+	parser.Exclude = append(project.Exclude, c.StringSlice("exclude")...)
+	parser.MaxDepth = c.Int("max-depth")
+	parser.NoIgnore = c.Bool("no-ignore")
+
+	if c.IsSet("include") {
+		parser.Include = c.StringSlice("include")
+	}
 	parser.Author = cfg.DefaultAuthor
 
-	// Execute parsing
-	return parser.ParseAll()
+	return parser, nil
 }
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTokenLifetime is how long a token lasts when the realm does not say, per the
+	// distribution token specification
+	defaultTokenLifetime = 60 * time.Second
+	// tokenExpiryMargin is how long before expiry a cached token stops being reused
+	tokenExpiryMargin = 10 * time.Second
+)
+
+// cachedToken is a bearer token and when it stops being valid
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// tokenCache keeps bearer tokens for reuse until shortly before they expire, keyed by the realm,
+// service and scope they were issued for
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+	now    func() time.Time
+}
+
+// newTokenCache creates an empty token cache
+func newTokenCache() *tokenCache {
+	return &tokenCache{
+		tokens: make(map[string]cachedToken),
+		now:    time.Now,
+	}
+}
+
+// tokenKey identifies the tokens a challenge can reuse
+func tokenKey(challenge Challenge) string {
+	return challenge.Registry + " " + challenge.Realm + " " + challenge.Service + " " + challenge.Scope
+}
+
+// get returns a cached token for the challenge if one is still valid
+func (c *tokenCache) get(challenge Challenge) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.tokens[tokenKey(challenge)]
+	if !ok || !c.now().Before(cached.expires) {
+		return "", false
+	}
+
+	return cached.token, true
+}
+
+// put stores a token for the challenge, to be reused until shortly before it expires
+func (c *tokenCache) put(challenge Challenge, token string, lifetime time.Duration) {
+	if lifetime <= 0 {
+		lifetime = defaultTokenLifetime
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tokens[tokenKey(challenge)] = cachedToken{
+		token:   token,
+		expires: c.now().Add(lifetime - tokenExpiryMargin),
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenCache(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := newTokenCache()
+	cache.now = func() time.Time { return now }
+
+	pull := Challenge{Realm: "https://auth.example.com/token", Service: "registry", Scope: "repository:org/app:pull"}
+	other := pull
+	other.Scope = "repository:org/other:pull"
+
+	cache.put(pull, "first", 5*time.Minute)
+
+	if token, ok := cache.get(pull); !ok || token != "first" {
+		t.Errorf("get() = %q, %v, want the cached token", token, ok)
+	}
+
+	if _, ok := cache.get(other); ok {
+		t.Errorf("get() found a token for a different scope")
+	}
+
+	now = now.Add(5*time.Minute - tokenExpiryMargin)
+
+	if _, ok := cache.get(pull); ok {
+		t.Errorf("get() returned a token about to expire")
+	}
+
+	cache.put(pull, "second", 0)
+
+	if token, ok := cache.get(pull); !ok || token != "second" {
+		t.Errorf("get() = %q, %v, want a token with the default lifetime", token, ok)
+	}
+}
+
+func TestDockerAuth_GetTokenReusesTokens(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`{"token":"abc","expires_in":300}`))
+	}))
+	t.Cleanup(server.Close)
+
+	service := NewDockerAuthWithClient(server.Client())
+	challenge := Challenge{Scheme: "bearer", Realm: server.URL, Scope: "repository:library/node:pull"}
+
+	for range 3 {
+		if _, err := service.GetToken(challenge); err != nil {
+			t.Fatalf("GetToken() error = %v", err)
+		}
+	}
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("GetToken() made %d token requests, want 1", got)
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Challenge is an authentication challenge from a registry's WWW-Authenticate header
+type Challenge struct {
+	Scheme  string
+	Realm   string
+	Service string
+	Scope   string
+	// Registry is the host that issued the challenge, used to look up stored credentials
+	Registry string
+}
+
+// dockerHubChallenge is the challenge Docker Hub issues, used when no registry has been asked
+var dockerHubChallenge = Challenge{
+	Scheme:   "bearer",
+	Realm:    "https://auth.docker.io/token",
+	Service:  "registry.docker.io",
+	Registry: "docker.io",
+}
+
+// ParseChallenge parses a WWW-Authenticate header such as
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull"
+func ParseChallenge(header string) (Challenge, error) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	if scheme == "" {
+		return Challenge{}, fmt.Errorf("empty authentication challenge")
+	}
+
+	challenge := Challenge{Scheme: strings.ToLower(scheme)}
+
+	for _, param := range splitParams(rest) {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "realm":
+			challenge.Realm = value
+		case "service":
+			challenge.Service = value
+		case "scope":
+			challenge.Scope = value
+		}
+	}
+
+	if challenge.Scheme == "bearer" && challenge.Realm == "" {
+		return Challenge{}, fmt.Errorf("bearer challenge has no realm: %s", header)
+	}
+
+	return challenge, nil
+}
+
+// splitParams splits challenge parameters on commas that are not inside quotes
+func splitParams(params string) []string {
+	var parts []string
+	var current strings.Builder
+	var quoted bool
+
+	for _, r := range params {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			parts = append(parts, current.String())
+			current.Reset()
+			continue
+		}
+
+		current.WriteRune(r)
+	}
+
+	return append(parts, current.String())
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// configAuthService authenticates with the credentials in the Docker CLI config, falling back to
+// anonymous tokens for registries it has no credentials for
+type configAuthService struct {
+	dockerAuthService
+	config *DockerConfig
+}
+
+// NewConfigAuth creates an authentication service that uses the logins and credential helpers in
+// $DOCKER_CONFIG/config.json or ~/.docker/config.json
+func NewConfigAuth(client *http.Client) (DockerAuth, error) {
+	path, err := DockerConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := LoadDockerConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewConfigAuthWithConfig(client, config), nil
+}
+
+// NewConfigAuthWithConfig creates an authentication service that uses the given Docker config
+func NewConfigAuthWithConfig(client *http.Client, config *DockerConfig) DockerAuth {
+	return &configAuthService{
+		dockerAuthService: dockerAuthService{client: client, tokens: newTokenCache()},
+		config:            config,
+	}
+}
+
+// GetAuthToken retrieves a token from Docker Hub for the specified image, using any stored login
+func (c *configAuthService) GetAuthToken(image string) (string, error) {
+	if err := validateImageName(image); err != nil {
+		return "", err
+	}
+
+	challenge := dockerHubChallenge
+	challenge.Scope = "repository:" + image + ":pull"
+
+	return c.GetToken(challenge)
+}
+
+// GetToken exchanges the stored credentials for the challenge's registry for a bearer token, or
+// fetches an anonymous one when there are none, reusing an earlier token for the same scope while
+// it is valid
+func (c *configAuthService) GetToken(challenge Challenge) (string, error) {
+	return c.cachedToken(challenge, func() (*http.Request, error) {
+		creds, ok, err := c.config.Credentials(challenge.Registry)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			return newTokenRequest(challenge)
+		}
+
+		return newLoginTokenRequest(challenge, creds)
+	})
+}
+
+// Authorize answers a registry's challenge with an Authorization header value, sending the stored
+// credentials directly to registries that ask for basic authentication
+func (c *configAuthService) Authorize(challenge Challenge) (string, error) {
+	if challenge.Scheme == "basic" {
+		creds, ok, err := c.config.Credentials(challenge.Registry)
+		if err != nil {
+			return "", err
+		}
+
+		if !ok {
+			return "", fmt.Errorf("%s requires basic authentication and no credentials are configured", challenge.Registry)
+		}
+
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(creds.Username+":"+creds.Secret)), nil
+	}
+
+	token, err := c.GetToken(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	return "Bearer " + token, nil
+}
+
+// newLoginTokenRequest builds a token request that presents stored credentials to the realm
+func newLoginTokenRequest(challenge Challenge, creds Credentials) (*http.Request, error) {
+	if creds.Username == identityTokenUser {
+		return newRefreshTokenRequest(challenge, creds.Secret)
+	}
+
+	req, err := newTokenRequest(challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetBasicAuth(creds.Username, creds.Secret)
+
+	return req, nil
+}
+
+// newRefreshTokenRequest builds an OAuth2 request exchanging an identity token for an access token
+func newRefreshTokenRequest(challenge Challenge, identityToken string) (*http.Request, error) {
+	if challenge.Realm == "" {
+		return nil, fmt.Errorf("authentication challenge has no realm")
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", identityToken)
+	form.Set("client_id", "stevedore")
+	form.Set("service", challenge.Service)
+
+	if challenge.Scope != "" {
+		form.Set("scope", challenge.Scope)
+	}
+
+	req, err := http.NewRequest("POST", challenge.Realm, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http request: %w", err)
+	}
+
+	req.Header.Add("accept", "application/json")
+	req.Header.Add("content-type", "application/x-www-form-urlencoded")
+
+	return req, nil
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConfigAuth_Authorize(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "refresh" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"access_token":"from-refresh"}`))
+			return
+		}
+
+		if user, pass, ok := r.BasicAuth(); ok {
+			if user != "octocat" || pass != "ghp_token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"token":"from-login"}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"token":"anonymous"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	service := NewConfigAuthWithConfig(server.Client(), &DockerConfig{
+		Auths: map[string]authEntry{
+			"ghcr.io":         {Username: "octocat", Password: "ghp_token"},
+			"harbor.internal": {IdentityToken: "refresh"},
+		},
+	})
+
+	tests := []struct {
+		name      string
+		challenge Challenge
+		want      string
+		wantErr   bool
+	}{
+		{"login", Challenge{Scheme: "bearer", Realm: server.URL, Registry: "ghcr.io"}, "Bearer from-login", false},
+		{"identity token", Challenge{Scheme: "bearer", Realm: server.URL, Registry: "harbor.internal"}, "Bearer from-refresh", false},
+		{"anonymous", Challenge{Scheme: "bearer", Realm: server.URL, Registry: "quay.io"}, "Bearer anonymous", false},
+		{"basic", Challenge{Scheme: "basic", Registry: "ghcr.io"}, "Basic b2N0b2NhdDpnaHBfdG9rZW4=", false},
+		{"basic without login", Challenge{Scheme: "basic", Registry: "quay.io"}, "", true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := service.Authorize(tt.challenge)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Authorize() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("Authorize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
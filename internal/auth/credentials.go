@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// dockerHubServer is the key Docker uses for Docker Hub in its config file and credential helpers
+	dockerHubServer = "https://index.docker.io/v1/"
+	// identityTokenUser is the username docker login stores alongside an identity token
+	identityTokenUser = "<token>"
+)
+
+// Credentials are a username and secret for a registry, in the form credential helpers return them
+type Credentials struct {
+	Username string `json:"Username"`
+	Secret   string `json:"Secret"`
+}
+
+// DockerConfig is the part of the Docker CLI config file that holds registry credentials
+type DockerConfig struct {
+	Auths       map[string]authEntry `json:"auths"`
+	CredHelpers map[string]string    `json:"credHelpers"`
+	CredsStore  string               `json:"credsStore"`
+}
+
+// authEntry is a stored login in the auths section of the config file
+type authEntry struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+// DockerConfigPath returns the path of the Docker CLI config file, in $DOCKER_CONFIG or ~/.docker
+func DockerConfigPath() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+
+	return filepath.Join(home, ".docker", "config.json"), nil
+}
+
+// LoadDockerConfig reads a Docker CLI config file. A missing file gives an empty config.
+func LoadDockerConfig(path string) (*DockerConfig, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &DockerConfig{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	config := &DockerConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// Credentials looks up the credentials for a registry host, trying a registry-specific credential
+// helper first, then the default credentials store, then the auths entries. It reports false when
+// none are configured.
+func (c *DockerConfig) Credentials(registry string) (Credentials, bool, error) {
+	if registry == "" {
+		return Credentials{}, false, nil
+	}
+
+	for key, helper := range c.CredHelpers {
+		if normalizeServer(key) == registry {
+			return runCredentialHelper(helper, key)
+		}
+	}
+
+	if c.CredsStore != "" {
+		creds, ok, err := runCredentialHelper(c.CredsStore, serverName(registry))
+		if err != nil || ok {
+			return creds, ok, err
+		}
+	}
+
+	for key, entry := range c.Auths {
+		if normalizeServer(key) == registry {
+			return entry.credentials()
+		}
+	}
+
+	return Credentials{}, false, nil
+}
+
+// credentials decodes a stored login, which holds either a base64 user:password pair, separate
+// fields, or an identity token
+func (e authEntry) credentials() (Credentials, bool, error) {
+	if e.IdentityToken != "" {
+		return Credentials{Username: identityTokenUser, Secret: e.IdentityToken}, true, nil
+	}
+
+	if e.Auth == "" {
+		return Credentials{Username: e.Username, Secret: e.Password}, e.Username != "", nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(e.Auth)
+	if err != nil {
+		return Credentials{}, false, fmt.Errorf("failed to decode auth entry: %w", err)
+	}
+
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return Credentials{}, false, fmt.Errorf("auth entry is not in user:password form")
+	}
+
+	return Credentials{Username: username, Secret: password}, true, nil
+}
+
+// normalizeServer reduces a config key, which may be a URL, to the registry host it names
+func normalizeServer(key string) string {
+	host := key
+	if _, rest, ok := strings.Cut(host, "://"); ok {
+		host = rest
+	}
+
+	host, _, _ = strings.Cut(host, "/")
+
+	switch host {
+	case "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+
+	return host
+}
+
+// serverName returns the name credential helpers store a registry's credentials under
+func serverName(registry string) string {
+	if registry == "docker.io" {
+		return dockerHubServer
+	}
+
+	return registry
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDockerConfig_Credentials(t *testing.T) {
+	t.Parallel()
+
+	config := &DockerConfig{
+		Auths: map[string]authEntry{
+			"https://index.docker.io/v1/":  {Auth: base64.StdEncoding.EncodeToString([]byte("hubuser:hubpass"))},
+			"ghcr.io":                      {Username: "octocat", Password: "ghp_token"},
+			"https://harbor.internal:8443": {IdentityToken: "refresh"},
+			"bad.example.com":              {Auth: "not base64!"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		registry string
+		want     Credentials
+		wantOK   bool
+		wantErr  bool
+	}{
+		{"docker hub", "docker.io", Credentials{"hubuser", "hubpass"}, true, false},
+		{"fields", "ghcr.io", Credentials{"octocat", "ghp_token"}, true, false},
+		{"identity token", "harbor.internal:8443", Credentials{identityTokenUser, "refresh"}, true, false},
+		{"none", "quay.io", Credentials{}, false, false},
+		{"undecodable", "bad.example.com", Credentials{}, false, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok, err := config.Credentials(tt.registry)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Credentials() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Credentials() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDockerConfig_CredentialHelpers(t *testing.T) {
+	bin := t.TempDir()
+	script := "#!/bin/sh\nread server\n" +
+		"case \"$server\" in\n" +
+		"  *.dkr.ecr.*) echo '{\"ServerURL\":\"'$server'\",\"Username\":\"AWS\",\"Secret\":\"ecr-pass\"}' ;;\n" +
+		"  https://index.docker.io/v1/) echo '{\"Username\":\"store\",\"Secret\":\"store-pass\"}' ;;\n" +
+		"  *) echo 'credentials not found in native keychain'; exit 1 ;;\n" +
+		"esac\n"
+
+	if err := os.WriteFile(filepath.Join(bin, "docker-credential-fake"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	config := &DockerConfig{
+		Auths:       map[string]authEntry{"ghcr.io": {Username: "octocat", Password: "ghp_token"}},
+		CredHelpers: map[string]string{"123456789012.dkr.ecr.eu-west-2.amazonaws.com": "fake"},
+		CredsStore:  "fake",
+	}
+
+	tests := []struct {
+		name     string
+		registry string
+		want     Credentials
+		wantOK   bool
+	}{
+		{"registry helper", "123456789012.dkr.ecr.eu-west-2.amazonaws.com", Credentials{"AWS", "ecr-pass"}, true},
+		{"store", "docker.io", Credentials{"store", "store-pass"}, true},
+		{"store misses", "ghcr.io", Credentials{"octocat", "ghp_token"}, true},
+		{"nothing", "quay.io", Credentials{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := config.Credentials(tt.registry)
+			if err != nil {
+				t.Fatalf("Credentials() error = %v", err)
+			}
+
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Credentials() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLoadDockerConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+
+	if err := os.WriteFile(path, []byte(`{"auths":{"ghcr.io":{"auth":"dTpw"}},"credsStore":"desktop"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadDockerConfig(path)
+	if err != nil {
+		t.Fatalf("LoadDockerConfig() error = %v", err)
+	}
+
+	if config.CredsStore != "desktop" || config.Auths["ghcr.io"].Auth != "dTpw" {
+		t.Errorf("LoadDockerConfig() = %+v", config)
+	}
+
+	missing, err := LoadDockerConfig(filepath.Join(dir, "missing.json"))
+	if err != nil || len(missing.Auths) != 0 {
+		t.Errorf("LoadDockerConfig() on a missing file = %+v, %v, want an empty config", missing, err)
+	}
+}
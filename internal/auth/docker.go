@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -13,19 +14,33 @@ import (
 // DockerAuth defines the interface for Docker registry authentication
 type DockerAuth interface {
 	GetAuthToken(image string) (string, error)
+	GetToken(challenge Challenge) (string, error)
+	Authorize(challenge Challenge) (string, error)
 }
 
 // dockerAuthService implements Docker registry authentication
 type dockerAuthService struct {
 	client *http.Client
+	tokens *tokenCache
 }
 
 // NewDockerAuth creates a new Docker authentication service with proper HTTP timeouts
 func NewDockerAuth() DockerAuth {
+	return NewDockerAuthWithTimeout(30 * time.Second)
+}
+
+// NewDockerAuthWithTimeout creates a new Docker authentication service with the given HTTP timeout
+func NewDockerAuthWithTimeout(timeout time.Duration) DockerAuth {
+	return NewDockerAuthWithClient(&http.Client{
+		Timeout: timeout,
+	})
+}
+
+// NewDockerAuthWithClient creates a new Docker authentication service using the given HTTP client
+func NewDockerAuthWithClient(client *http.Client) DockerAuth {
 	return &dockerAuthService{
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		client: client,
+		tokens: newTokenCache(),
 	}
 }
 
@@ -35,18 +50,96 @@ func (d *dockerAuthService) GetAuthToken(image string) (string, error) {
 		return "", err
 	}
 
-	url := "https://auth.docker.io/token?service=registry.docker.io&scope=repository:" + image + ":pull"
-	req, err := http.NewRequest("GET", url, nil)
+	challenge := dockerHubChallenge
+	challenge.Scope = "repository:" + image + ":pull"
+
+	return d.GetToken(challenge)
+}
+
+// GetToken retrieves an anonymous bearer token from the realm named in a registry's challenge,
+// reusing an earlier token for the same scope while it is valid
+func (d *dockerAuthService) GetToken(challenge Challenge) (string, error) {
+	return d.cachedToken(challenge, func() (*http.Request, error) {
+		return newTokenRequest(challenge)
+	})
+}
+
+// cachedToken returns a valid cached token for the challenge, or fetches one with the request
+// built by newRequest and caches it for as long as the realm says it lasts
+func (d *dockerAuthService) cachedToken(challenge Challenge, newRequest func() (*http.Request, error)) (string, error) {
+	if token, ok := d.tokens.get(challenge); ok {
+		log.Debug().Msgf("reusing token for %s", challenge.Scope)
+		return token, nil
+	}
+
+	req, err := newRequest()
+	if err != nil {
+		return "", err
+	}
+
+	token, lifetime, err := d.fetchToken(req)
+	if err != nil {
+		return "", err
+	}
+
+	d.tokens.put(challenge, token, lifetime)
+
+	return token, nil
+}
+
+// Authorize answers a registry's challenge with an Authorization header value. Anonymous access
+// only works for bearer challenges.
+func (d *dockerAuthService) Authorize(challenge Challenge) (string, error) {
+	if challenge.Scheme != "bearer" {
+		return "", fmt.Errorf("%s requires %s authentication and no credentials are configured", challenge.Registry, challenge.Scheme)
+	}
+
+	token, err := d.GetToken(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	return "Bearer " + token, nil
+}
+
+// newTokenRequest builds the request for a token from the challenge's realm
+func newTokenRequest(challenge Challenge) (*http.Request, error) {
+	if challenge.Realm == "" {
+		return nil, fmt.Errorf("authentication challenge has no realm")
+	}
+
+	realm, err := url.Parse(challenge.Realm)
+	if err != nil {
+		return nil, fmt.Errorf("invalid realm %s: %w", challenge.Realm, err)
+	}
+
+	query := realm.Query()
+	if challenge.Service != "" {
+		query.Set("service", challenge.Service)
+	}
+
+	if challenge.Scope != "" {
+		query.Set("scope", challenge.Scope)
+	}
+
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", realm.String(), nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create http request: %w", err)
+		return nil, fmt.Errorf("failed to create http request: %w", err)
 	}
 
 	req.Header.Add("accept", "application/json")
 	req.Header.Add("content-type", "application/json")
 
+	return req, nil
+}
+
+// fetchToken executes a token request and extracts the token, and how long it lasts, from the response
+func (d *dockerAuthService) fetchToken(req *http.Request) (string, time.Duration, error) {
 	res, err := d.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute http request: %w", err)
+		return "", 0, fmt.Errorf("failed to execute http request: %w", err)
 	}
 
 	defer func() {
@@ -56,29 +149,37 @@ func (d *dockerAuthService) GetAuthToken(image string) (string, error) {
 	}()
 
 	if res.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", res.StatusCode)
+		return "", 0, fmt.Errorf("unexpected status code: %d", res.StatusCode)
 	}
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		return "", 0, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	var jsonMap map[string]interface{}
 	if err := json.Unmarshal(body, &jsonMap); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		return "", 0, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
+	// registries may use either name for the token
 	token, ok := jsonMap["token"].(string)
 	if !ok {
-		return "", fmt.Errorf("token not found in response or invalid type")
+		token, ok = jsonMap["access_token"].(string)
+	}
+
+	if !ok {
+		return "", 0, fmt.Errorf("token not found in response or invalid type")
 	}
 
 	if token == "" {
-		return "", fmt.Errorf("empty token received")
+		return "", 0, fmt.Errorf("empty token received")
 	}
 
-	return token, nil
+	// JSON numbers decode as float64; a missing lifetime falls back to the default
+	expiresIn, _ := jsonMap["expires_in"].(float64)
+
+	return token, time.Duration(expiresIn) * time.Second, nil
 }
 
 // validateImageName performs basic validation on Docker image names
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// credentialsNotFound is the message credential helpers print when they hold nothing for a server
+const credentialsNotFound = "credentials not found"
+
+// runCredentialHelper asks a docker-credential-<helper> binary for a server's credentials, writing
+// the server name to its stdin and reading JSON from its stdout
+func runCredentialHelper(helper, server string) (Credentials, bool, error) {
+	if helper == "" || strings.ContainsAny(helper, `/\`) {
+		return Credentials{}, false, fmt.Errorf("invalid credential helper name %q", helper)
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	//#nosec
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(strings.ToLower(stdout.String()), credentialsNotFound) {
+			return Credentials{}, false, nil
+		}
+
+		return Credentials{}, false, fmt.Errorf("credential helper %s failed: %w: %s",
+			helper, err, strings.TrimSpace(stderr.String()+stdout.String()))
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return Credentials{}, false, fmt.Errorf("failed to parse credential helper %s output: %w", helper, err)
+	}
+
+	if creds.Secret == "" {
+		return Credentials{}, false, nil
+	}
+
+	return creds, true, nil
+}
@@ -0,0 +1,259 @@
+// Package ci reads what continuous integration systems tell a job about its repository and run
+// through environment variables, for checkouts where git knows too little
+package ci
+
+import (
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/jameswoolfenden/stevedore/internal/git"
+)
+
+// Info is what a CI provider reports about the pipeline run. Fields the provider does not set are empty.
+type Info struct {
+	Provider string
+	Org      string
+	Repo     string
+	// RemoteURL is the repository's clone or web URL
+	RemoteURL string
+	Commit    string
+	Ref       string
+	Branch    string
+	Tag       string
+	// Email is the address of whoever triggered the run
+	Email  string
+	RunID  string
+	RunURL string
+	// Workspace is the directory the repository is checked out to
+	Workspace string
+}
+
+// provider detects one CI system and reads its variables
+type provider struct {
+	name   string
+	detect func(env getenv) bool
+	read   func(env getenv) Info
+}
+
+// getenv looks up an environment variable, empty when unset
+type getenv func(key string) string
+
+var providers = []provider{
+	{"github-actions", func(env getenv) bool { return env("GITHUB_ACTIONS") == "true" }, gitHubActions},
+	{"gitlab-ci", func(env getenv) bool { return env("GITLAB_CI") != "" }, gitLabCI},
+	{"jenkins", func(env getenv) bool { return env("JENKINS_URL") != "" }, jenkins},
+	{"azure-pipelines", func(env getenv) bool { return strings.EqualFold(env("TF_BUILD"), "true") }, azurePipelines},
+	{"circleci", func(env getenv) bool { return env("CIRCLECI") == "true" }, circleCI},
+	{"bitbucket-pipelines", func(env getenv) bool { return env("BITBUCKET_BUILD_NUMBER") != "" }, bitbucket},
+}
+
+// Detect returns what the CI system this process runs under reports, and false outside CI
+func Detect() (Info, bool) {
+	return detect(os.Getenv)
+}
+
+func detect(env getenv) (Info, bool) {
+	for _, p := range providers {
+		if p.detect(env) {
+			info := p.read(env)
+			info.Provider = p.name
+
+			return info, true
+		}
+	}
+
+	return Info{}, false
+}
+
+func gitHubActions(env getenv) Info {
+	server := strings.TrimSuffix(env("GITHUB_SERVER_URL"), "/")
+	repository := env("GITHUB_REPOSITORY")
+	org, repo := splitPath(repository)
+
+	info := Info{
+		Org:       org,
+		Repo:      repo,
+		Commit:    env("GITHUB_SHA"),
+		Ref:       env("GITHUB_REF"),
+		RunID:     env("GITHUB_RUN_ID"),
+		Workspace: env("GITHUB_WORKSPACE"),
+	}
+
+	if server != "" && repository != "" {
+		info.RemoteURL = server + "/" + repository
+		if info.RunID != "" {
+			info.RunURL = info.RemoteURL + "/actions/runs/" + info.RunID
+		}
+	}
+
+	switch env("GITHUB_REF_TYPE") {
+	case "branch":
+		// pull requests check out a merge ref, so the branch is the head of the pull request
+		info.Branch = first(env("GITHUB_HEAD_REF"), env("GITHUB_REF_NAME"))
+	case "tag":
+		info.Tag = env("GITHUB_REF_NAME")
+	default:
+		info.Branch, info.Tag = fromRef(info.Ref)
+	}
+
+	return info
+}
+
+func gitLabCI(env getenv) Info {
+	return Info{
+		Org:       env("CI_PROJECT_NAMESPACE"),
+		Repo:      env("CI_PROJECT_NAME"),
+		RemoteURL: env("CI_PROJECT_URL"),
+		Commit:    env("CI_COMMIT_SHA"),
+		Ref:       env("CI_COMMIT_REF_NAME"),
+		Branch:    first(env("CI_COMMIT_BRANCH"), env("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME")),
+		Tag:       env("CI_COMMIT_TAG"),
+		Email:     env("GITLAB_USER_EMAIL"),
+		RunID:     env("CI_PIPELINE_ID"),
+		RunURL:    env("CI_PIPELINE_URL"),
+		Workspace: env("CI_PROJECT_DIR"),
+	}
+}
+
+func jenkins(env getenv) Info {
+	remote := env("GIT_URL")
+	org, repo := splitRemote(remote)
+
+	info := Info{
+		Org:       org,
+		Repo:      repo,
+		RemoteURL: git.StripCredentials(remote),
+		Commit:    env("GIT_COMMIT"),
+		Ref:       env("GIT_BRANCH"),
+		Tag:       env("TAG_NAME"),
+		Email:     env("CHANGE_AUTHOR_EMAIL"),
+		RunID:     env("BUILD_NUMBER"),
+		RunURL:    env("BUILD_URL"),
+		Workspace: env("WORKSPACE"),
+	}
+
+	// multibranch pipelines set BRANCH_NAME, freestyle jobs only the remote tracking branch
+	if info.Tag == "" {
+		info.Branch = first(env("CHANGE_BRANCH"), env("BRANCH_NAME"), strings.TrimPrefix(info.Ref, "origin/"))
+	}
+
+	return info
+}
+
+func azurePipelines(env getenv) Info {
+	remote := env("BUILD_REPOSITORY_URI")
+	org, repo := splitPath(env("BUILD_REPOSITORY_NAME"))
+
+	// Azure Repos names the repository alone, so the organisation and project come from its URL
+	if org == "" {
+		org, _ = splitRemote(remote)
+	}
+
+	info := Info{
+		Org:       org,
+		Repo:      repo,
+		RemoteURL: remote,
+		Commit:    env("BUILD_SOURCEVERSION"),
+		Ref:       env("BUILD_SOURCEBRANCH"),
+		Email:     env("BUILD_REQUESTEDFOREMAIL"),
+		RunID:     env("BUILD_BUILDID"),
+		Workspace: env("BUILD_SOURCESDIRECTORY"),
+	}
+
+	info.Branch, info.Tag = fromRef(info.Ref)
+
+	if pr := env("SYSTEM_PULLREQUEST_SOURCEBRANCH"); pr != "" {
+		info.Branch, _ = fromRef(pr)
+	}
+
+	if collection, project := env("SYSTEM_COLLECTIONURI"), env("SYSTEM_TEAMPROJECT"); collection != "" &&
+		project != "" && info.RunID != "" {
+		info.RunURL = strings.TrimSuffix(collection, "/") + "/" + url.PathEscape(project) +
+			"/_build/results?buildId=" + info.RunID
+	}
+
+	return info
+}
+
+func circleCI(env getenv) Info {
+	return Info{
+		Org:       env("CIRCLE_PROJECT_USERNAME"),
+		Repo:      env("CIRCLE_PROJECT_REPONAME"),
+		RemoteURL: env("CIRCLE_REPOSITORY_URL"),
+		Commit:    env("CIRCLE_SHA1"),
+		Ref:       first(env("CIRCLE_TAG"), env("CIRCLE_BRANCH")),
+		Branch:    env("CIRCLE_BRANCH"),
+		Tag:       env("CIRCLE_TAG"),
+		RunID:     env("CIRCLE_BUILD_NUM"),
+		RunURL:    env("CIRCLE_BUILD_URL"),
+		Workspace: env("CIRCLE_WORKING_DIRECTORY"),
+	}
+}
+
+func bitbucket(env getenv) Info {
+	origin := strings.TrimSuffix(env("BITBUCKET_GIT_HTTP_ORIGIN"), "/")
+
+	info := Info{
+		Org:       env("BITBUCKET_WORKSPACE"),
+		Repo:      env("BITBUCKET_REPO_SLUG"),
+		RemoteURL: origin,
+		Commit:    env("BITBUCKET_COMMIT"),
+		Ref:       first(env("BITBUCKET_TAG"), env("BITBUCKET_BRANCH")),
+		Branch:    env("BITBUCKET_BRANCH"),
+		Tag:       env("BITBUCKET_TAG"),
+		RunID:     env("BITBUCKET_BUILD_NUMBER"),
+		Workspace: env("BITBUCKET_CLONE_DIR"),
+	}
+
+	if origin != "" && info.RunID != "" {
+		info.RunURL = origin + "/addon/pipelines/home#!/results/" + info.RunID
+	}
+
+	return info
+}
+
+// fromRef splits a full git ref into a branch or a tag
+func fromRef(ref string) (string, string) {
+	switch {
+	case strings.HasPrefix(ref, "refs/heads/"):
+		return strings.TrimPrefix(ref, "refs/heads/"), ""
+	case strings.HasPrefix(ref, "refs/tags/"):
+		return "", strings.TrimPrefix(ref, "refs/tags/")
+	default:
+		return "", ""
+	}
+}
+
+// splitPath splits an org/repo path, keeping any subgroups with the organisation
+func splitPath(path string) (string, string) {
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+
+	index := strings.LastIndex(path, "/")
+	if index < 0 {
+		return "", path
+	}
+
+	return path[:index], path[index+1:]
+}
+
+// splitRemote reads the organisation and repository from a clone URL
+func splitRemote(remote string) (string, string) {
+	parsed, err := git.ParseRemote(remote)
+	if err != nil {
+		return "", ""
+	}
+
+	return parsed.Org, parsed.Repo
+}
+
+// first returns the first non-empty value
+func first(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,127 @@
+package ci
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		env    map[string]string
+		want   Info
+		wantOK bool
+	}{
+		{"none", map[string]string{"HOME": "/root"}, Info{}, false},
+		{"github actions pull request", map[string]string{
+			"GITHUB_ACTIONS":    "true",
+			"GITHUB_SERVER_URL": "https://github.com",
+			"GITHUB_REPOSITORY": "acme/widget",
+			"GITHUB_SHA":        "abc123",
+			"GITHUB_REF":        "refs/pull/7/merge",
+			"GITHUB_REF_NAME":   "7/merge",
+			"GITHUB_REF_TYPE":   "branch",
+			"GITHUB_HEAD_REF":   "feature",
+			"GITHUB_RUN_ID":     "42",
+			"GITHUB_WORKSPACE":  "/work/widget",
+		}, Info{
+			Provider: "github-actions", Org: "acme", Repo: "widget", RemoteURL: "https://github.com/acme/widget",
+			Commit: "abc123", Ref: "refs/pull/7/merge", Branch: "feature", RunID: "42",
+			RunURL: "https://github.com/acme/widget/actions/runs/42", Workspace: "/work/widget",
+		}, true},
+		{"github actions tag", map[string]string{
+			"GITHUB_ACTIONS":    "true",
+			"GITHUB_REPOSITORY": "acme/widget",
+			"GITHUB_REF":        "refs/tags/v1.0.0",
+			"GITHUB_REF_NAME":   "v1.0.0",
+			"GITHUB_REF_TYPE":   "tag",
+		}, Info{Provider: "github-actions", Org: "acme", Repo: "widget", Ref: "refs/tags/v1.0.0", Tag: "v1.0.0"}, true},
+		{"gitlab subgroup", map[string]string{
+			"GITLAB_CI":            "true",
+			"CI_PROJECT_NAMESPACE": "acme/platform",
+			"CI_PROJECT_NAME":      "widget",
+			"CI_PROJECT_URL":       "https://gitlab.com/acme/platform/widget",
+			"CI_COMMIT_SHA":        "abc123",
+			"CI_COMMIT_REF_NAME":   "main",
+			"CI_COMMIT_BRANCH":     "main",
+			"GITLAB_USER_EMAIL":    "dev@acme.com",
+			"CI_PIPELINE_ID":       "42",
+			"CI_PIPELINE_URL":      "https://gitlab.com/acme/platform/widget/-/pipelines/42",
+		}, Info{
+			Provider: "gitlab-ci", Org: "acme/platform", Repo: "widget",
+			RemoteURL: "https://gitlab.com/acme/platform/widget", Commit: "abc123", Ref: "main", Branch: "main",
+			Email: "dev@acme.com", RunID: "42", RunURL: "https://gitlab.com/acme/platform/widget/-/pipelines/42",
+		}, true},
+		{"jenkins freestyle", map[string]string{
+			"JENKINS_URL":  "https://ci.acme.com/",
+			"GIT_URL":      "git@github.com:acme/widget.git",
+			"GIT_COMMIT":   "abc123",
+			"GIT_BRANCH":   "origin/main",
+			"BUILD_NUMBER": "42",
+			"BUILD_URL":    "https://ci.acme.com/job/widget/42/",
+			"WORKSPACE":    "/var/jenkins/widget",
+		}, Info{
+			Provider: "jenkins", Org: "acme", Repo: "widget", RemoteURL: "git@github.com:acme/widget.git",
+			Commit: "abc123", Ref: "origin/main", Branch: "main", RunID: "42",
+			RunURL: "https://ci.acme.com/job/widget/42/", Workspace: "/var/jenkins/widget",
+		}, true},
+		{"azure repos", map[string]string{
+			"TF_BUILD":                "True",
+			"BUILD_REPOSITORY_NAME":   "widget",
+			"BUILD_REPOSITORY_URI":    "https://dev.azure.com/acme/Platform/_git/widget",
+			"BUILD_SOURCEVERSION":     "abc123",
+			"BUILD_SOURCEBRANCH":      "refs/tags/v1.0.0",
+			"BUILD_REQUESTEDFOREMAIL": "dev@acme.com",
+			"BUILD_BUILDID":           "42",
+			"SYSTEM_COLLECTIONURI":    "https://dev.azure.com/acme/",
+			"SYSTEM_TEAMPROJECT":      "Platform",
+		}, Info{
+			Provider: "azure-pipelines", Org: "acme/Platform", Repo: "widget",
+			RemoteURL: "https://dev.azure.com/acme/Platform/_git/widget", Commit: "abc123",
+			Ref: "refs/tags/v1.0.0", Tag: "v1.0.0", Email: "dev@acme.com", RunID: "42",
+			RunURL: "https://dev.azure.com/acme/Platform/_build/results?buildId=42",
+		}, true},
+		{"circleci", map[string]string{
+			"CIRCLECI":                "true",
+			"CIRCLE_PROJECT_USERNAME": "acme",
+			"CIRCLE_PROJECT_REPONAME": "widget",
+			"CIRCLE_SHA1":             "abc123",
+			"CIRCLE_BRANCH":           "main",
+			"CIRCLE_BUILD_NUM":        "42",
+			"CIRCLE_BUILD_URL":        "https://circleci.com/gh/acme/widget/42",
+		}, Info{
+			Provider: "circleci", Org: "acme", Repo: "widget", Commit: "abc123", Ref: "main", Branch: "main",
+			RunID: "42", RunURL: "https://circleci.com/gh/acme/widget/42",
+		}, true},
+		{"bitbucket", map[string]string{
+			"BITBUCKET_BUILD_NUMBER":    "42",
+			"BITBUCKET_WORKSPACE":       "acme",
+			"BITBUCKET_REPO_SLUG":       "widget",
+			"BITBUCKET_COMMIT":          "abc123",
+			"BITBUCKET_TAG":             "v1.0.0",
+			"BITBUCKET_GIT_HTTP_ORIGIN": "http://bitbucket.org/acme/widget",
+		}, Info{
+			Provider: "bitbucket-pipelines", Org: "acme", Repo: "widget",
+			RemoteURL: "http://bitbucket.org/acme/widget", Commit: "abc123", Ref: "v1.0.0", Tag: "v1.0.0",
+			RunID: "42", RunURL: "http://bitbucket.org/acme/widget/addon/pipelines/home#!/results/42",
+		}, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := detect(func(key string) string { return tt.env[key] })
+			if ok != tt.wantOK {
+				t.Fatalf("detect() ok = %v, want %v", ok, tt.wantOK)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detect() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
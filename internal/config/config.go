@@ -4,18 +4,47 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
 )
 
+// Log formats supported by SetupLogging
+const (
+	LogFormatConsole = "console"
+	LogFormatJSON    = "json"
+)
+
+// EnvPrefix is the prefix of the environment variables that override configuration
+const EnvPrefix = "STEVEDORE_"
+
 // Config holds the application configuration
 type Config struct {
 	DefaultAuthor string
 	Output        string
 	LogLevel      string
+	LogFormat     string
 	HTTPTimeout   time.Duration
+	// Cache keeps registry manifests and config blobs on disk between runs
+	Cache bool
+	// Offline answers registry lookups from the disk cache only
+	Offline bool
+	// Project holds the label settings of the config file, empty when there is none
+	Project *Project
+}
+
+// fileConfig is the layout of the settings in a config file
+type fileConfig struct {
+	Author      *string `yaml:"author"`
+	Output      *string `yaml:"output"`
+	LogLevel    *string `yaml:"log-level"`
+	LogFormat   *string `yaml:"log-format"`
+	HTTPTimeout *string `yaml:"http-timeout"`
+	Cache       *string `yaml:"cache"`
+	Offline     *string `yaml:"offline"`
 }
 
 // NewConfig creates a new configuration with sensible defaults
@@ -24,8 +53,104 @@ func NewConfig() *Config {
 		DefaultAuthor: "",
 		Output:        ".",
 		LogLevel:      "info",
+		LogFormat:     LogFormatConsole,
 		HTTPTimeout:   30 * time.Second,
+		Project:       &Project{},
+	}
+}
+
+// LoadFile overrides the configuration with the settings in a YAML file, such as .stevedore.yaml
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	var file fileConfig
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return c.apply(file, "config file "+path)
+}
+
+// LoadEnv overrides the configuration with any STEVEDORE_* environment variables that are set
+func (c *Config) LoadEnv() error {
+	var env fileConfig
+
+	for name, value := range map[string]**string{
+		"AUTHOR":       &env.Author,
+		"OUTPUT":       &env.Output,
+		"LOG_LEVEL":    &env.LogLevel,
+		"LOG_FORMAT":   &env.LogFormat,
+		"HTTP_TIMEOUT": &env.HTTPTimeout,
+		"CACHE":        &env.Cache,
+		"OFFLINE":      &env.Offline,
+	} {
+		if setting, ok := os.LookupEnv(EnvPrefix + name); ok {
+			*value = &setting
+		}
+	}
+
+	return c.apply(env, "environment")
+}
+
+// apply copies the settings that are present, naming the source in any error
+func (c *Config) apply(settings fileConfig, source string) error {
+	if settings.Author != nil {
+		c.DefaultAuthor = *settings.Author
+	}
+
+	if settings.Output != nil {
+		c.Output = *settings.Output
+	}
+
+	if settings.LogLevel != nil {
+		c.LogLevel = *settings.LogLevel
+	}
+
+	if settings.LogFormat != nil {
+		c.LogFormat = *settings.LogFormat
 	}
+
+	if settings.HTTPTimeout != nil {
+		timeout, err := time.ParseDuration(*settings.HTTPTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid http-timeout %q in %s: %w", *settings.HTTPTimeout, source, err)
+		}
+
+		c.HTTPTimeout = timeout
+	}
+
+	if settings.Cache != nil {
+		cache, err := parseBool("cache", *settings.Cache, source)
+		if err != nil {
+			return err
+		}
+
+		c.Cache = cache
+	}
+
+	if settings.Offline != nil {
+		offline, err := parseBool("offline", *settings.Offline, source)
+		if err != nil {
+			return err
+		}
+
+		c.Offline = offline
+	}
+
+	return nil
+}
+
+// parseBool parses an on/off setting, naming the setting and its source in any error
+func parseBool(name, value, source string) (bool, error) {
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q in %s: %w", name, value, source, err)
+	}
+
+	return result, nil
 }
 
 // Validate performs validation on the configuration
@@ -36,12 +161,28 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if _, err := zerolog.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("invalid log level %q, expected one of trace, debug, info, warn, error, fatal or panic", c.LogLevel)
+	}
+
+	if c.LogFormat != LogFormatConsole && c.LogFormat != LogFormatJSON {
+		return fmt.Errorf("invalid log format %q, expected %s or %s", c.LogFormat, LogFormatConsole, LogFormatJSON)
+	}
+
+	if c.HTTPTimeout <= 0 {
+		return fmt.Errorf("invalid http timeout %s, it must be greater than zero", c.HTTPTimeout)
+	}
+
 	return nil
 }
 
 // SetupLogging configures the logging based on the config
 func (c *Config) SetupLogging() error {
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	if c.LogFormat == LogFormatJSON {
+		log.Logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
+	} else {
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	}
 
 	level, err := zerolog.ParseLevel(c.LogLevel)
 	if err != nil {
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfig_Layers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ProjectFileName)
+
+	if err := os.WriteFile(path, []byte("author: From File\nlog-level: warn\nhttp-timeout: 5s\ncache: true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("STEVEDORE_LOG_LEVEL", "debug")
+	t.Setenv("STEVEDORE_LOG_FORMAT", "json")
+	t.Setenv("STEVEDORE_OFFLINE", "1")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	if err := cfg.LoadEnv(); err != nil {
+		t.Fatalf("LoadEnv() error = %v", err)
+	}
+
+	want := &Config{
+		DefaultAuthor: "From File",
+		Output:        ".",
+		LogLevel:      "debug",
+		LogFormat:     LogFormatJSON,
+		HTTPTimeout:   5 * time.Second,
+		Cache:         true,
+		Offline:       true,
+		Project:       cfg.Project,
+	}
+
+	if *cfg != *want {
+		t.Errorf("config = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr bool
+	}{
+		{"defaults", func(*Config) {}, false},
+		{"log level", func(c *Config) { c.LogLevel = "loud" }, true},
+		{"log format", func(c *Config) { c.LogFormat = "xml" }, true},
+		{"timeout", func(c *Config) { c.HTTPTimeout = 0 }, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := NewConfig()
+			tt.modify(cfg)
+
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFileName is the name of the per-project configuration file
+const ProjectFileName = ".stevedore.yaml"
+
+// Project holds the label settings declared in a project's .stevedore.yaml
+type Project struct {
+	// Path is the file the settings were read from, empty when no project file was found
+	Path string `yaml:"-"`
+	// Schema selects the built-in label keys: legacy, oci or both
+	Schema string `yaml:"schema"`
+	// Prefix is prepended to every key stevedore writes, other than the OCI keys
+	Prefix string `yaml:"prefix"`
+	// Keys limits the built-in keys written, by full key or by name without the layer prefix
+	Keys []string `yaml:"keys"`
+	// Labels are static key/value pairs added to every stage
+	Labels map[string]string `yaml:"labels"`
+	// Templates are Go template values rendered against git, user and environment data
+	Templates map[string]string `yaml:"templates"`
+	// Licenses is the SPDX license expression for the OCI schema
+	Licenses string `yaml:"licenses"`
+	// Required are the keys the check command requires
+	Required []string `yaml:"required"`
+	// Include are the name patterns of the files a directory scan takes to be Dockerfiles
+	Include []string `yaml:"include"`
+	// Exclude are name patterns of files and directories a directory scan skips
+	Exclude []string `yaml:"exclude"`
+}
+
+// FindProject walks up the directory tree from dir looking for a .stevedore.yaml, the same way
+// the git service looks for .git. An empty Project is returned when there is none.
+func FindProject(dir string) (*Project, error) {
+	current, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	if info, err := os.Stat(current); err == nil && !info.IsDir() {
+		current = filepath.Dir(current)
+	}
+
+	for {
+		path := filepath.Join(current, ProjectFileName)
+
+		if _, err := os.Stat(path); err == nil {
+			return LoadProject(path)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return &Project{}, nil
+		}
+		current = parent
+	}
+}
+
+// LoadProject reads and validates a project file
+func LoadProject(path string) (*Project, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	project := &Project{}
+	if err := yaml.Unmarshal(data, project); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	project.Path = path
+
+	if err := project.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+
+	return project, nil
+}
+
+// Validate checks that every template value can be parsed
+func (p *Project) Validate() error {
+	for key, value := range p.Templates {
+		if _, err := template.New(key).Parse(value); err != nil {
+			return fmt.Errorf("invalid template for %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
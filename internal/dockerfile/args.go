@@ -0,0 +1,73 @@
+package dockerfile
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/shell"
+	"github.com/rs/zerolog/log"
+)
+
+// argEnv holds build argument values for shell expansion
+type argEnv map[string]string
+
+// Get returns the value of a build argument
+func (a argEnv) Get(key string) (string, bool) {
+	value, ok := a[key]
+	return value, ok
+}
+
+// Keys returns the names of the build arguments
+func (a argEnv) Keys() []string {
+	keys := make([]string, 0, len(a))
+	for key := range a {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// globalArgs collects the default values of the ARG instructions declared before the first FROM,
+// which are the only arguments a FROM line can reference
+func (d *Dockerfile) globalArgs() argEnv {
+	args := make(argEnv)
+
+	if d.Parsed == nil {
+		return args
+	}
+
+	for _, child := range d.Parsed.AST.Children {
+		if strings.EqualFold(child.Value, "from") {
+			break
+		}
+
+		if !strings.EqualFold(child.Value, "arg") {
+			continue
+		}
+
+		for arg := child.Next; arg != nil; arg = arg.Next {
+			name, value, ok := strings.Cut(arg.Value, "=")
+			if !ok {
+				continue
+			}
+
+			args[name] = expand(value, args)
+		}
+	}
+
+	return args
+}
+
+// expand substitutes build arguments in a word the way the Dockerfile frontend does, leaving it
+// unchanged if it cannot be processed
+func expand(word string, args argEnv) string {
+	result, _, err := shell.NewLex('\\').ProcessWord(word, args)
+	if err != nil {
+		log.Warn().Err(err).Msgf("failed to expand %s", word)
+		return word
+	}
+
+	return result
+}
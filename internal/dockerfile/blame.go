@@ -0,0 +1,118 @@
+package dockerfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// blameLabels names the author and commit of the lines that introduced a stage's FROM, and of
+// the most recent change to any of its instructions. LABEL instructions are left out so that
+// stevedore's own edits are not taken for changes to the stage. Lines not yet committed have
+// no blame and are skipped.
+func (l *Labeller) blameLabels(stage *Stage, filePath string) ([]labelPair, string) {
+	if l.gitService == nil {
+		return nil, ""
+	}
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, fmt.Sprintf("blame unavailable: %s", err)
+	}
+
+	blame, err := l.gitService.GetFileBlame(absPath)
+	if err != nil {
+		return nil, fmt.Sprintf("blame unavailable: %s", err)
+	}
+
+	content, err := os.ReadFile(absPath) //#nosec G304 -- the Dockerfile being labelled
+	if err != nil {
+		return nil, fmt.Sprintf("blame unavailable: %s", err)
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+
+	var pairs []labelPair
+
+	if from := latestBlame(blame, lines, stage.From, nil); from != nil {
+		pairs = append(pairs,
+			labelPair{Key: layerKey(stage.Layer, "from.author"), Value: from.Author},
+			labelPair{Key: layerKey(stage.Layer, "from.commit"), Value: from.Hash.String()},
+		)
+	}
+
+	var changed *gogit.Line
+
+	for _, node := range stage.Nodes {
+		if !isLabelNode(node) {
+			changed = latestBlame(blame, lines, node, changed)
+		}
+	}
+
+	if changed != nil {
+		pairs = append(pairs,
+			labelPair{Key: layerKey(stage.Layer, "changed.author"), Value: changed.Author},
+			labelPair{Key: layerKey(stage.Layer, "changed.commit"), Value: changed.Hash.String()},
+		)
+	}
+
+	return pairs, ""
+}
+
+// latestBlame returns whichever is more recent of latest and the blame of the lines an
+// instruction spans
+func latestBlame(blame *gogit.BlameResult, lines []string, node *parser.Node, latest *gogit.Line) *gogit.Line {
+	for n := node.StartLine; n <= node.EndLine; n++ {
+		line := blameLine(blame, lines, n)
+		if line != nil && (latest == nil || line.Date.After(latest.Date)) {
+			latest = line
+		}
+	}
+
+	return latest
+}
+
+// blameLine finds the blame for a line of the working copy. The blame describes the file at HEAD,
+// so where uncommitted edits have moved the line it is matched by text, taking the nearest line
+// with the same content.
+func blameLine(blame *gogit.BlameResult, lines []string, n int) *gogit.Line {
+	index := n - 1
+	if index < 0 || index >= len(lines) {
+		return nil
+	}
+
+	text := lines[index]
+
+	if index < len(blame.Lines) && blame.Lines[index].Text == text {
+		return blame.Lines[index]
+	}
+
+	var nearest *gogit.Line
+
+	distance := len(blame.Lines) + len(lines)
+
+	for i, line := range blame.Lines {
+		if line.Text != text {
+			continue
+		}
+
+		if d := abs(i - index); d < distance {
+			nearest, distance = line, d
+		}
+	}
+
+	return nearest
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
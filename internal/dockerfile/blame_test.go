@@ -0,0 +1,118 @@
+package dockerfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jameswoolfenden/stevedore/internal/git"
+)
+
+func TestLabeller_blameLabels(t *testing.T) {
+	t.Parallel()
+
+	dir := writeTree(t, map[string]string{
+		"Dockerfile": "FROM alpine AS build\nRUN make\n\nFROM scratch\nCOPY --from=build /app /app\n",
+	})
+	commitAll(t, dir, "alice@example.com")
+
+	// blame dates have one second resolution, so the second commit must be seen as newer
+	time.Sleep(time.Second)
+
+	path := filepath.Join(dir, "Dockerfile")
+	if err := os.WriteFile(path,
+		[]byte("FROM alpine AS build\nRUN make all\n\nFROM scratch\nCOPY --from=build /app /app\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	commitAll(t, dir, "bob@example.com")
+
+	// uncommitted edits move lines and add ones blame knows nothing about
+	if err := os.WriteFile(path, []byte("# syntax=docker/dockerfile:1\nFROM alpine AS build\nRUN make all\n"+
+		"LABEL a=b\n\nFROM scratch\nCOPY --from=build /app /app\nRUN uncommitted\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := git.NewGitService(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blame, err := service.GetFileBlame(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := blame.Lines[0].Hash.String(), blame.Lines[1].Hash.String()
+
+	dockerfile := &Dockerfile{Path: path}
+	if err := dockerfile.ParseFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	labeller := NewLabeler(service, nil)
+	stages := dockerfile.Stages()
+
+	tests := []struct {
+		name  string
+		stage *Stage
+		want  []labelPair
+	}{
+		{"changed since from", stages[0], []labelPair{
+			{Key: "layer.0.from.author", Value: "alice@example.com"},
+			{Key: "layer.0.from.commit", Value: first},
+			{Key: "layer.0.changed.author", Value: "bob@example.com"},
+			{Key: "layer.0.changed.commit", Value: second},
+		}},
+		{"unchanged", stages[1], []labelPair{
+			{Key: "layer.0.from.author", Value: "alice@example.com"},
+			{Key: "layer.0.from.commit", Value: first},
+			{Key: "layer.0.changed.author", Value: "alice@example.com"},
+			{Key: "layer.0.changed.commit", Value: first},
+		}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, warning := labeller.blameLabels(tt.stage, path)
+			if warning != "" {
+				t.Fatalf("blameLabels() warning = %s", warning)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("blameLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabeller_blameLabelsUncommitted(t *testing.T) {
+	t.Parallel()
+
+	dir := writeTree(t, map[string]string{"README.md": "readme\n"})
+	commitAll(t, dir, "alice@example.com")
+
+	path := filepath.Join(dir, "Dockerfile")
+	if err := os.WriteFile(path, []byte("FROM alpine\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := git.NewGitService(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dockerfile := &Dockerfile{Path: path}
+	if err := dockerfile.ParseFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, warning := NewLabeler(service, nil).blameLabels(dockerfile.Stages()[0], path)
+	if got != nil || warning == "" {
+		t.Errorf("blameLabels() = %v, %q, want a warning and no labels", got, warning)
+	}
+}
@@ -0,0 +1,166 @@
+package dockerfile
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// FindingKind classifies a problem found by Check
+type FindingKind string
+
+const (
+	// FindingMissing is a required label that is absent or empty
+	FindingMissing FindingKind = "missing"
+	// FindingStale is a label whose value no longer matches what stevedore would write
+	FindingStale FindingKind = "stale"
+)
+
+// authorKeyPattern matches the author keys, whose value depends on who ran stevedore
+var authorKeyPattern = regexp.MustCompile(`(^|\.)(layer\.\d+\.author|org\.opencontainers\.image\.authors)$`)
+
+// Finding is a problem with the labels of a build stage
+type Finding struct {
+	Path  string `json:"path"`
+	Stage string `json:"stage"`
+	// Line is where the stale label is declared, or the stage's FROM for a missing one
+	Line int         `json:"line"`
+	Key  string      `json:"key"`
+	Kind FindingKind `json:"kind"`
+	Got  string      `json:"got,omitempty"`
+	Want string      `json:"want,omitempty"`
+}
+
+// String describes the finding for console output
+func (f Finding) String() string {
+	if f.Kind == FindingStale {
+		return fmt.Sprintf("%s [stage %s]: stale label %q, got %q want %q", f.Path, f.Stage, f.Key, f.Got, f.Want)
+	}
+
+	return fmt.Sprintf("%s [stage %s]: missing label %q", f.Path, f.Stage, f.Key)
+}
+
+// Check verifies that each selected stage declares the required labels with non-empty values, and that
+// the labels stevedore owns still match what it would write. With no required keys, those from the
+// project file are used, and failing that every label that stevedore writes with a value is
+// required. A required key may be given without its layer prefix, so "author" matches
+// layer.N.author. Keys recording the commit the labels were written at are not compared, since
+// committing the labels moves HEAD on.
+func (l *Labeller) Check(dockerfile *Dockerfile, authorOverride string, required []string) ([]Finding, error) {
+	if dockerfile.Parsed == nil {
+		return nil, fmt.Errorf("dockerfile is nil")
+	}
+
+	stages, parents, err := l.prepareStages(dockerfile)
+	if err != nil {
+		return nil, err
+	}
+
+	myUser := l.currentUser(authorOverride)
+
+	if len(required) == 0 && l.Project != nil {
+		required = l.Project.Required
+	}
+
+	var findings []Finding
+
+	for _, stage := range l.chooseStages(stages) {
+		desired, _ := l.desiredLabels(stage, myUser, dockerfile.Path, len(stages) > 1, parents[stage.Index])
+		findings = append(findings, checkStage(dockerfile.Path, stage, desired, required, authorOverride != "")...)
+	}
+
+	return findings, nil
+}
+
+// checkStage compares the labels declared in a stage with the required and desired labels
+func checkStage(path string, stage *Stage, desired []labelPair, required []string, checkAuthor bool) []Finding {
+	declared := stage.Labels()
+
+	wanted := make(map[string]string, len(desired))
+	for _, pair := range desired {
+		wanted[pair.Key] = pair.Value
+	}
+
+	if len(required) == 0 {
+		for _, pair := range desired {
+			if pair.Value != "" {
+				required = append(required, pair.Key)
+			}
+		}
+	}
+
+	var findings []Finding
+
+	for _, key := range required {
+		key = resolveKey(key, stage.Layer, declared, wanted)
+
+		got := declared[key]
+		finding := Finding{Path: path, Stage: stage.ID(), Line: stage.From.StartLine, Key: key, Got: got}
+
+		want, owned := wanted[key]
+
+		switch {
+		case got == "":
+			finding.Kind = FindingMissing
+		case !owned || isVolatileKey(key) || isHeadKey(key) ||
+			(!checkAuthor && authorKeyPattern.MatchString(key)) || got == want:
+			continue
+		default:
+			finding.Kind = FindingStale
+			finding.Want = want
+			finding.Line = labelLine(stage, key)
+		}
+
+		findings = append(findings, finding)
+	}
+
+	return findings
+}
+
+// labelLine returns the line of the last LABEL in the stage that declares the key
+func labelLine(stage *Stage, key string) int {
+	line := stage.From.StartLine
+
+	for _, child := range stage.Nodes {
+		if !isLabelNode(child) {
+			continue
+		}
+
+		for _, pair := range labelPairs(child) {
+			if pair.Key == key {
+				line = child.StartLine
+			}
+		}
+	}
+
+	return line
+}
+
+// resolveKey expands a required key given without its layer or project prefix, such as "author",
+// into the full key declared in or written to the stage
+func resolveKey(key string, layer int64, declared, wanted map[string]string) string {
+	if _, ok := declared[key]; ok {
+		return key
+	}
+
+	if _, ok := wanted[key]; ok {
+		return key
+	}
+
+	layered := layerKey(layer, key)
+	candidates := sortedKeys(wanted)
+
+	for _, suffix := range []string{layered, "." + layered, "." + key} {
+		for _, candidate := range candidates {
+			if candidate == suffix || strings.HasSuffix(candidate, suffix) {
+				return candidate
+			}
+		}
+	}
+
+	if _, ok := declared[layered]; ok {
+		return layered
+	}
+
+	return key
+}
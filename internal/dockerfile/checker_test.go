@@ -0,0 +1,122 @@
+package dockerfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jameswoolfenden/stevedore/internal/git"
+)
+
+func TestCheckStage(t *testing.T) {
+	t.Parallel()
+
+	desired := []labelPair{
+		{Key: "layer.0.author", Value: "James Woolfenden"},
+		{Key: "layer.0.trace", Value: "new"},
+		{Key: "git_file", Value: "app/Dockerfile"},
+		{Key: "git_repo", Value: ""},
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		required []string
+		want     []Finding
+	}{
+		{
+			"complete",
+			"FROM alpine\nLABEL layer.0.author=someone layer.0.trace=old git_file=app/Dockerfile\n",
+			nil,
+			nil,
+		},
+		{
+			"missing",
+			"FROM alpine\nLABEL layer.0.author=someone owner=\n",
+			[]string{"author", "owner", "git_file"},
+			[]Finding{
+				{Path: "Dockerfile", Stage: "0", Line: 1, Key: "owner", Kind: FindingMissing},
+				{Path: "Dockerfile", Stage: "0", Line: 1, Key: "git_file", Kind: FindingMissing},
+			},
+		},
+		{
+			"stale",
+			"FROM alpine\nLABEL layer.0.author=someone layer.0.trace=old git_file=Dockerfile\n",
+			nil,
+			[]Finding{
+				{Path: "Dockerfile", Stage: "0", Line: 2, Key: "git_file", Kind: FindingStale, Got: "Dockerfile", Want: "app/Dockerfile"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			stage := parseSource(t, tt.source).Stages()[0]
+
+			if got := checkStage("Dockerfile", stage, desired, tt.required, false); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkStage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabeller_CheckAfterCommit(t *testing.T) {
+	t.Parallel()
+
+	dir := writeTree(t, map[string]string{
+		"Dockerfile": "FROM alpine AS build\nRUN make\n\nFROM scratch\nCOPY --from=build /app /app\n",
+	})
+	commitAll(t, dir, "alice@example.com")
+
+	path := filepath.Join(dir, "Dockerfile")
+
+	labelled := func() *Labeller {
+		service, err := git.NewGitService(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		labeller := NewLabeler(service, nil)
+		labeller.Schema = SchemaBoth
+		labeller.Blame = true
+
+		return labeller
+	}
+
+	dockerfile := &Dockerfile{Path: path}
+	if err := dockerfile.ParseFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	dump, err := labelled().Label(dockerfile, "")
+	if err != nil {
+		t.Fatalf("Label() error = %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(dump), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// committing the labels moves HEAD past the commit they record; commit times have one second
+	// resolution, so wait for the commit time to move as well
+	time.Sleep(time.Second)
+	commitAll(t, dir, "alice@example.com")
+
+	dockerfile = &Dockerfile{Path: path}
+	if err := dockerfile.ParseFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	findings, err := labelled().Check(dockerfile, "", nil)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+
+	if len(findings) != 0 {
+		t.Errorf("Check() = %v, want no findings after committing the labels", findings)
+	}
+}
@@ -0,0 +1,142 @@
+package dockerfile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// diffLine is a single line of a diff, kind being ' ', '-' or '+'
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// unifiedDiff renders the line differences between before and after as a unified diff,
+// returning an empty string when they are the same
+func unifiedDiff(path, before, after string) string {
+	if before == after {
+		return ""
+	}
+
+	lines := diffLines(before, after)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", path, path)
+
+	for i := 0; i < len(lines); {
+		for i < len(lines) && lines[i].kind == ' ' {
+			i++
+		}
+
+		if i == len(lines) {
+			break
+		}
+
+		start := max(0, i-diffContext)
+		end := hunkEnd(lines, i)
+		writeHunk(&out, lines, start, end)
+		i = end
+	}
+
+	return out.String()
+}
+
+// diffLines computes a line-level diff using go-diff's line mode
+func diffLines(before, after string) []diffLine {
+	dmp := diffmatchpatch.New()
+	a, b, index := dmp.DiffLinesToChars(before, after)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(a, b, false), index)
+
+	var lines []diffLine
+
+	for _, d := range diffs {
+		kind := byte(' ')
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			kind = '-'
+		case diffmatchpatch.DiffInsert:
+			kind = '+'
+		}
+
+		for _, text := range strings.SplitAfter(d.Text, "\n") {
+			if text != "" {
+				lines = append(lines, diffLine{kind: kind, text: text})
+			}
+		}
+	}
+
+	return lines
+}
+
+// hunkEnd finds where a hunk starting with the change at i ends, merging changes separated by
+// no more than twice the context
+func hunkEnd(lines []diffLine, i int) int {
+	end := i
+
+	for end < len(lines) {
+		if lines[end].kind != ' ' {
+			end++
+			continue
+		}
+
+		run := 0
+		for end+run < len(lines) && lines[end+run].kind == ' ' {
+			run++
+		}
+
+		if end+run == len(lines) || run > 2*diffContext {
+			return end + min(run, diffContext)
+		}
+
+		end += run
+	}
+
+	return end
+}
+
+// writeHunk writes lines[start:end] as a hunk with its header
+func writeHunk(out *strings.Builder, lines []diffLine, start, end int) {
+	oldStart, newStart := 1, 1
+	for _, line := range lines[:start] {
+		if line.kind != '+' {
+			oldStart++
+		}
+		if line.kind != '-' {
+			newStart++
+		}
+	}
+
+	var oldCount, newCount int
+	for _, line := range lines[start:end] {
+		if line.kind != '+' {
+			oldCount++
+		}
+		if line.kind != '-' {
+			newCount++
+		}
+	}
+
+	// an empty range refers to the line before it
+	if oldCount == 0 {
+		oldStart--
+	}
+	if newCount == 0 {
+		newStart--
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+
+	for _, line := range lines[start:end] {
+		out.WriteByte(line.kind)
+		out.WriteString(line.text)
+
+		if !strings.HasSuffix(line.text, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package dockerfile
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{"same", "FROM alpine\n", "FROM alpine\n", ""},
+		{
+			"append",
+			"FROM alpine\nRUN a\nRUN b\nRUN c\nRUN d\n",
+			"FROM alpine\nRUN a\nRUN b\nRUN c\nRUN d\nLABEL a=b\n",
+			"--- a/Dockerfile\n+++ b/Dockerfile\n@@ -3,3 +3,4 @@\n RUN b\n RUN c\n RUN d\n+LABEL a=b\n",
+		},
+		{
+			"replace without trailing newline",
+			"FROM alpine\nLABEL a=b",
+			"FROM alpine\nLABEL a=c\n",
+			"--- a/Dockerfile\n+++ b/Dockerfile\n@@ -1,2 +1,2 @@\n FROM alpine\n-LABEL a=b\n\\ No newline at end of file\n+LABEL a=c\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := unifiedDiff("Dockerfile", tt.before, tt.after); got != tt.want {
+				t.Errorf("unifiedDiff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package dockerfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultInclude are the names taken to be Dockerfiles when no include patterns are given
+var defaultInclude = []string{
+	"Dockerfile", "Dockerfile.*", "*.Dockerfile", "*.dockerfile", "Containerfile", "Containerfile.*",
+}
+
+// defaultExclude are never scanned: version control metadata, vendored dependencies, documentation,
+// the ignore files BuildKit reads beside a Dockerfile, such as Dockerfile.dockerignore, and the
+// files editors and merge tools leave behind
+var defaultExclude = []string{
+	".git", "node_modules", "vendor",
+	"*.md", "*.dockerignore", "*~", "*.swp", "*.swo", "*.bak", "*.orig", ".#*", "#*#", "*.tmp",
+}
+
+// walker finds the Dockerfiles under a directory
+type walker struct {
+	root     string
+	include  []string
+	exclude  []string
+	maxDepth int
+	ignore   bool
+
+	gitignore    []gitignore.Pattern
+	dockerignore *patternmatcher.PatternMatcher
+	files        []string
+}
+
+// newWalker checks the patterns and reads the .dockerignore at the root, unless ignore files are
+// not honoured
+func newWalker(p *Parser) (*walker, error) {
+	if p.MaxDepth < 0 {
+		return nil, fmt.Errorf("max depth cannot be negative: %d", p.MaxDepth)
+	}
+
+	w := &walker{
+		root:     p.Directory,
+		include:  p.Include,
+		exclude:  append(append([]string{}, defaultExclude...), p.Exclude...),
+		maxDepth: p.MaxDepth,
+		ignore:   !p.NoIgnore,
+	}
+
+	if len(w.include) == 0 {
+		w.include = defaultInclude
+	}
+
+	for _, pattern := range append(append([]string{}, w.include...), w.exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	if w.ignore {
+		matcher, err := readDockerignore(filepath.Join(w.root, ".dockerignore"))
+		if err != nil {
+			return nil, err
+		}
+
+		w.dockerignore = matcher
+	}
+
+	return w, nil
+}
+
+// walk lists the Dockerfiles under the root in lexical order
+func (w *walker) walk() ([]string, error) {
+	if err := filepath.WalkDir(w.root, w.visit); err != nil {
+		return nil, err
+	}
+
+	return w.files, nil
+}
+
+// visit decides whether to descend into a directory or keep a file
+func (w *walker) visit(filePath string, entry fs.DirEntry, err error) error {
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(w.root, filePath)
+	if err != nil {
+		return err
+	}
+
+	if rel == "." {
+		return w.readGitignore(filePath, nil)
+	}
+
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+
+	if entry.IsDir() {
+		if w.skipDir(rel, parts) {
+			log.Debug().Msgf("skipping directory: %s", filePath)
+			return filepath.SkipDir
+		}
+
+		return w.readGitignore(filePath, parts)
+	}
+
+	if matchAny(w.include, parts) && !matchAny(w.exclude, parts) && !w.gitignored(parts, false) {
+		w.files = append(w.files, filePath)
+	}
+
+	return nil
+}
+
+// skipDir reports whether a directory is beyond the maximum depth, excluded or ignored.
+// A .dockerignore only prunes directories: Docker reads the Dockerfile itself even when it is
+// left out of the build context, so a Dockerfile listed there is still found.
+func (w *walker) skipDir(rel string, parts []string) bool {
+	if w.maxDepth > 0 && len(parts) >= w.maxDepth {
+		return true
+	}
+
+	if matchAny(w.exclude, parts) || w.gitignored(parts, true) {
+		return true
+	}
+
+	if w.dockerignore == nil || w.dockerignore.Exclusions() {
+		return false
+	}
+
+	matched, err := w.dockerignore.MatchesOrParentMatches(rel)
+	if err != nil {
+		log.Warn().Err(err).Msgf("failed to match %s against .dockerignore", rel)
+		return false
+	}
+
+	return matched
+}
+
+// gitignored reports whether a path is ignored by the .gitignore files read so far
+func (w *walker) gitignored(parts []string, isDir bool) bool {
+	if len(w.gitignore) == 0 {
+		return false
+	}
+
+	return gitignore.NewMatcher(w.gitignore).Match(parts, isDir)
+}
+
+// readGitignore adds the patterns of the .gitignore in a directory, scoped to that directory
+func (w *walker) readGitignore(dir string, domain []string) error {
+	if !w.ignore {
+		return nil
+	}
+
+	//#nosec
+	data, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to read .gitignore: %w", err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		w.gitignore = append(w.gitignore, gitignore.ParsePattern(line, domain))
+	}
+
+	return nil
+}
+
+// readDockerignore reads the patterns of a .dockerignore, matching nothing when there is none
+func readDockerignore(filePath string) (*patternmatcher.PatternMatcher, error) {
+	var patterns []string
+
+	//#nosec
+	data, err := os.ReadFile(filePath)
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read .dockerignore: %w", err)
+	default:
+		if patterns, err = ignorefile.ReadAll(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+		}
+	}
+
+	matcher, err := patternmatcher.New(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern in %s: %w", filePath, err)
+	}
+
+	return matcher, nil
+}
+
+// matchAny reports whether a path matches any of the patterns. Patterns with a slash match the
+// path relative to the root, other patterns match the last element of the path.
+func matchAny(patterns []string, parts []string) bool {
+	name := parts[len(parts)-1]
+	rel := strings.Join(parts, "/")
+
+	for _, pattern := range patterns {
+		target := name
+		if strings.Contains(pattern, "/") {
+			target = rel
+		}
+
+		if matched, _ := path.Match(pattern, target); matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,164 @@
+package dockerfile
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParser_directoryFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := writeTree(t, map[string]string{
+		"Dockerfile":                      "FROM alpine\n",
+		"Dockerfile.dev":                  "FROM alpine\n",
+		"Dockerfile.md":                   "# docs\n",
+		"Dockerfile.dockerignore":         "*.log\n",
+		"Dockerfile~":                     "FROM alpine\n",
+		"Dockerfile.bak":                  "FROM alpine\n",
+		".Dockerfile.swp":                 "",
+		"Containerfile":                   "FROM alpine\n",
+		"api/api.Dockerfile":              "FROM alpine\n",
+		"api/build.dockerfile":            "FROM alpine\n",
+		"api/NotADockerfileAtAll":         "",
+		"api/api.Dockerfile.dockerignore": "*.log\n",
+		"api/deep/er/Dockerfile":          "FROM alpine\n",
+		".git/Dockerfile":                 "FROM alpine\n",
+		"node_modules/pkg/Dockerfile":     "FROM alpine\n",
+		"vendor/mod/Dockerfile":           "FROM alpine\n",
+		".gitignore":                      "build/\n",
+		"build/Dockerfile":                "FROM alpine\n",
+		"web/.gitignore":                  "Dockerfile.local\n",
+		"web/Dockerfile":                  "FROM alpine\n",
+		"web/Dockerfile.local":            "FROM alpine\n",
+		".dockerignore":                   "testdata\nDockerfile\n",
+		"testdata/Dockerfile":             "FROM alpine\n",
+		"examples/Dockerfile":             "FROM alpine\n",
+		"examples/example.Containerfile":  "FROM alpine\n",
+	})
+
+	defaults := []string{
+		"Containerfile",
+		"Dockerfile",
+		"Dockerfile.dev",
+		"api/api.Dockerfile",
+		"api/build.dockerfile",
+		"api/deep/er/Dockerfile",
+		"examples/Dockerfile",
+		"web/Dockerfile",
+	}
+
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		maxDepth int
+		noIgnore bool
+		want     []string
+	}{
+		{"defaults", nil, nil, 0, false, defaults},
+		{"exclude appends", nil, []string{"examples", "*.dev"}, 0, false, []string{
+			"Containerfile",
+			"Dockerfile",
+			"api/api.Dockerfile",
+			"api/build.dockerfile",
+			"api/deep/er/Dockerfile",
+			"web/Dockerfile",
+		}},
+		{"include replaces", []string{"*.Containerfile"}, nil, 0, false, []string{
+			"examples/example.Containerfile",
+		}},
+		{"include path", []string{"api/*"}, nil, 0, false, []string{
+			"api/NotADockerfileAtAll",
+			"api/api.Dockerfile",
+			"api/build.dockerfile",
+		}},
+		{"max depth", nil, nil, 1, false, []string{
+			"Containerfile",
+			"Dockerfile",
+			"Dockerfile.dev",
+		}},
+		{"max depth two", nil, nil, 2, false, []string{
+			"Containerfile",
+			"Dockerfile",
+			"Dockerfile.dev",
+			"api/api.Dockerfile",
+			"api/build.dockerfile",
+			"examples/Dockerfile",
+			"web/Dockerfile",
+		}},
+		{"no ignore", nil, nil, 0, true, []string{
+			"Containerfile",
+			"Dockerfile",
+			"Dockerfile.dev",
+			"api/api.Dockerfile",
+			"api/build.dockerfile",
+			"api/deep/er/Dockerfile",
+			"build/Dockerfile",
+			"examples/Dockerfile",
+			"testdata/Dockerfile",
+			"web/Dockerfile",
+			"web/Dockerfile.local",
+		}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			parser := NewParser(NewLabeler(nil, nil))
+			parser.Directory = dir
+			parser.Include = tt.include
+			parser.Exclude = tt.exclude
+			parser.MaxDepth = tt.maxDepth
+			parser.NoIgnore = tt.noIgnore
+
+			files, err := parser.directoryFiles()
+			if err != nil {
+				t.Fatalf("directoryFiles() error = %v", err)
+			}
+
+			var got []string
+			for _, file := range files {
+				rel, err := filepath.Rel(dir, file)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got = append(got, filepath.ToSlash(rel))
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("directoryFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParser_directoryFilesInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		include  []string
+		maxDepth int
+	}{
+		{"bad pattern", []string{"[Dockerfile"}, 0},
+		{"negative depth", nil, -1},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			parser := NewParser(NewLabeler(nil, nil))
+			parser.Directory = t.TempDir()
+			parser.Include = tt.include
+			parser.MaxDepth = tt.maxDepth
+
+			if _, err := parser.directoryFiles(); err == nil {
+				t.Errorf("directoryFiles() error = nil, want an error")
+			}
+		})
+	}
+}
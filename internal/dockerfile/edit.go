@@ -0,0 +1,79 @@
+package dockerfile
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// edit describes a change to a single instruction in a Dockerfile
+type edit struct {
+	node   *parser.Node // instruction being replaced, or the one the new text follows
+	text   string       // replacement text, empty to remove the instruction
+	insert bool         // add text after node instead of replacing it
+}
+
+// applyEdits splices the edits into the original source, using each node's line range so that
+// comments, blank lines, directives and the formatting of untouched instructions are preserved
+func applyEdits(source []byte, edits []edit) string {
+	lines := strings.SplitAfter(string(source), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	eol := "\n"
+	if strings.Contains(string(source), "\r\n") {
+		eol = "\r\n"
+	}
+
+	// Apply from the bottom of the file up so earlier line numbers stay valid. For the same
+	// instruction, text inserted after it goes in before it is replaced, last insert first.
+	order := make([]int, len(edits))
+	for i := range order {
+		order[i] = len(edits) - 1 - i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := edits[order[i]], edits[order[j]]
+		if a.node.EndLine != b.node.EndLine {
+			return a.node.EndLine > b.node.EndLine
+		}
+
+		return a.insert && !b.insert
+	})
+
+	for _, i := range order {
+		e := edits[i]
+		start, end := e.node.StartLine-1, e.node.EndLine
+		if start < 0 || end > len(lines) {
+			continue
+		}
+
+		if e.insert {
+			if !strings.HasSuffix(lines[end-1], "\n") {
+				lines[end-1] += eol
+			}
+
+			lines = splice(lines, end, end, e.text+eol)
+			continue
+		}
+
+		if e.text == "" {
+			lines = splice(lines, start, end)
+		} else {
+			lines = splice(lines, start, end, e.text+eol)
+		}
+	}
+
+	return strings.Join(lines, "")
+}
+
+// splice replaces lines[start:end] with the given lines
+func splice(lines []string, start, end int, replacement ...string) []string {
+	result := make([]string, 0, len(lines)-(end-start)+len(replacement))
+	result = append(result, lines[:start]...)
+	result = append(result, replacement...)
+
+	return append(result, lines[end:]...)
+}
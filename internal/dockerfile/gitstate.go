@@ -0,0 +1,177 @@
+package dockerfile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// scanned records the files this run scans, so that the labels written to them are not taken for
+// changes to the tree. It is called before any file is processed.
+func (l *Labeller) scanned(files []string) {
+	l.dockerfiles = make(map[string]bool, len(files))
+
+	for _, file := range files {
+		if absPath, err := filepath.Abs(file); err == nil {
+			l.dockerfiles[absPath] = true
+		}
+	}
+}
+
+// treeDirty reports whether any tracked file has uncommitted changes, leaving out changes to the
+// labels stevedore owns in Dockerfiles. The working tree is checked once and the answer shared by
+// every Dockerfile.
+func (l *Labeller) treeDirty() (bool, error) {
+	l.dirtyOnce.Do(func() {
+		files, err := l.gitService.GetChangedFiles()
+		if err != nil {
+			l.dirtyErr = err
+			return
+		}
+
+		for _, file := range files {
+			dirty := l.contentDirty
+			if l.isDockerfile(file) {
+				dirty = l.fileDirty
+			}
+
+			if dirty(file) {
+				l.dirty = true
+				return
+			}
+		}
+	})
+
+	return l.dirty, l.dirtyErr
+}
+
+// isDockerfile reports whether a file is one this run scans or is named as a Dockerfile is by default
+func (l *Labeller) isDockerfile(absPath string) bool {
+	return l.dockerfiles[absPath] || matchAny(defaultInclude, []string{filepath.Base(absPath)})
+}
+
+// contentDirty reports whether a file differs from HEAD at all. A file that is not committed, or
+// no longer exists, is dirty.
+func (l *Labeller) contentDirty(absPath string) bool {
+	committed, current, ok := l.versions(absPath)
+
+	return !ok || !bytes.Equal(committed, current)
+}
+
+// fileDirty reports whether a Dockerfile differs from HEAD other than in the labels stevedore
+// owns, so the labels it writes do not make the next run see a dirty file. A file that is not
+// committed, or no longer exists, is dirty.
+func (l *Labeller) fileDirty(absPath string) bool {
+	committed, current, ok := l.versions(absPath)
+	if !ok {
+		return true
+	}
+
+	if bytes.Equal(committed, current) {
+		return false
+	}
+
+	before, ok := l.userInstructions(committed)
+	if !ok {
+		return true
+	}
+
+	after, ok := l.userInstructions(current)
+
+	return !ok || !slices.Equal(before, after)
+}
+
+// versions reads a file as committed at HEAD and as it is in the working tree, returning false
+// when either is missing
+func (l *Labeller) versions(absPath string) ([]byte, []byte, bool) {
+	committed, err := l.gitService.GetHeadContent(absPath)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	current, err := os.ReadFile(absPath) //#nosec G304 -- path comes from the git worktree
+	if err != nil {
+		return nil, nil, false
+	}
+
+	return committed, current, true
+}
+
+// userInstructions returns the text of every instruction with the comments before it, leaving out
+// the labels stevedore owns and any LABEL left empty without them. It returns false when the
+// content is not a Dockerfile.
+func (l *Labeller) userInstructions(content []byte) ([]string, bool) {
+	parsed, err := parser.Parse(bytes.NewReader(content))
+	if err != nil || parsed.AST == nil {
+		return nil, false
+	}
+
+	var instructions []string
+
+	for _, node := range parsed.AST.Children {
+		instructions = append(instructions, node.PrevComment...)
+
+		if !isLabelNode(node) {
+			instructions = append(instructions, node.Original)
+			continue
+		}
+
+		var kept []string
+
+		pairs := labelPairs(node)
+		marked := isMarked(pairs)
+
+		for _, pair := range pairs {
+			if !l.ownsKey(pair.Key, marked) {
+				kept = append(kept, pair.raw)
+			}
+		}
+
+		if len(kept) > 0 {
+			instructions = append(instructions, "LABEL "+strings.Join(kept, " "))
+		}
+	}
+
+	return instructions, true
+}
+
+// ownsKey reports whether stevedore writes a label key: one of its own keys, or a label the
+// project file declares, with or without the project's prefix. OCI keys are stevedore's in a LABEL
+// it marked, or when it writes them without a marker under the oci schema.
+func (l *Labeller) ownsKey(key string, marked bool) bool {
+	if ociKeyPattern.MatchString(key) {
+		return marked || l.Schema == SchemaOCI
+	}
+
+	keys := []string{key}
+
+	if l.Project != nil && l.Project.Prefix != "" {
+		if unprefixed, ok := strings.CutPrefix(key, l.Project.Prefix); ok {
+			keys = append(keys, unprefixed)
+		}
+	}
+
+	for _, key := range keys {
+		if ownedKeyPattern.MatchString(key) {
+			return true
+		}
+
+		if l.Project == nil {
+			continue
+		}
+
+		if _, ok := l.Project.Labels[key]; ok {
+			return true
+		}
+
+		if _, ok := l.Project.Templates[key]; ok {
+			return true
+		}
+	}
+
+	return false
+}
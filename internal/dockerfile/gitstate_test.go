@@ -0,0 +1,138 @@
+package dockerfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/jameswoolfenden/stevedore/internal/config"
+	"github.com/jameswoolfenden/stevedore/internal/git"
+)
+
+func TestLabeller_fileDirty(t *testing.T) {
+	t.Parallel()
+
+	committed := "FROM alpine\nLABEL a=b\nRUN true\n"
+	project := &config.Project{Prefix: "com.acme.", Labels: map[string]string{"team": "platform"}}
+
+	tests := []struct {
+		name      string
+		file      string
+		committed string
+		content   string
+		scanned   bool
+		want      bool
+	}{
+		{"unchanged", "Dockerfile", committed, committed, false, false},
+		{"owned labels only", "Dockerfile", committed,
+			"FROM alpine\nLABEL a=b \\\n    git_dirty=\"false\" com.acme.layer.0.trace=x\nRUN true\n", false, false},
+		{"stevedore label added", "Dockerfile", committed,
+			"FROM alpine\nLABEL a=b\nRUN true\nLABEL layer.0.author=x com.acme.team=platform\n", false, false},
+		{"user label changed", "Dockerfile", committed, "FROM alpine\nLABEL a=c git_dirty=true\nRUN true\n", false, true},
+		{"user label added", "Dockerfile", committed, "FROM alpine\nLABEL a=b\nRUN true\nLABEL maintainer=me\n", false, true},
+		{"user OCI label changed", "Dockerfile", "FROM alpine\nLABEL org.opencontainers.image.licenses=MIT\n",
+			"FROM alpine\nLABEL org.opencontainers.image.licenses=Apache-2.0\n", false, true},
+		{"marked OCI label changed", "Dockerfile", "FROM alpine\nLABEL layer.0.tool=stevedore org.opencontainers.image.created=x\n",
+			"FROM alpine\nLABEL layer.0.tool=stevedore org.opencontainers.image.created=y\n", false, false},
+		{"comment changed", "Dockerfile", committed, "# build\nFROM alpine\nLABEL a=b\nRUN true\n", false, true},
+		{"instruction changed", "Dockerfile", committed, "FROM alpine\nLABEL a=b\nRUN false\n", false, true},
+		{"not a dockerfile", "Dockerfile", committed, "", false, true},
+		{"other file comment changed", "run.sh", "# build\nmake\n", "# build it\nmake\n", false, true},
+		{"scanned file labels only", "app.docker", committed, "FROM alpine\nLABEL a=b git_commit=x\nRUN true\n", true, false},
+		{"unscanned file labels only", "app.docker", committed, "FROM alpine\nLABEL a=b git_commit=x\nRUN true\n", false, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := writeTree(t, map[string]string{tt.file: tt.committed})
+			commitAll(t, dir, "test@example.com")
+
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			service, err := git.NewGitService(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			labeller := NewLabeler(service, nil)
+			labeller.Project = project
+
+			if tt.scanned {
+				labeller.scanned([]string{path})
+			}
+
+			if got := labeller.fileDirty(path); tt.file == "Dockerfile" && got != tt.want {
+				t.Errorf("fileDirty() = %v, want %v", got, tt.want)
+			}
+
+			if got, err := labeller.treeDirty(); err != nil || got != tt.want {
+				t.Errorf("treeDirty() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabeller_fileDirtyUncommitted(t *testing.T) {
+	t.Parallel()
+
+	dir := writeTree(t, map[string]string{"README.md": "readme\n"})
+	commitAll(t, dir, "test@example.com")
+
+	path := filepath.Join(dir, "Dockerfile")
+	if err := os.WriteFile(path, []byte("FROM alpine\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := git.NewGitService(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labeller := NewLabeler(service, nil)
+
+	if !labeller.fileDirty(path) {
+		t.Errorf("fileDirty() = false, want true for a file not yet committed")
+	}
+
+	if got, err := labeller.treeDirty(); err != nil || got {
+		t.Errorf("treeDirty() = %v, %v, want untracked files ignored", got, err)
+	}
+}
+
+// commitAll commits everything in dir as the given author, initialising the repository first
+// when there is none
+func commitAll(t *testing.T, dir, email string) {
+	t.Helper()
+
+	repository, err := gogit.PlainOpen(dir)
+	if err != nil {
+		repository, err = gogit.PlainInit(dir, false)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worktree, err := repository.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := worktree.AddGlob("."); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := worktree.Commit("commit", &gogit.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: email, When: time.Now()},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,120 @@
+package dockerfile
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/jameswoolfenden/stevedore/internal/registry"
+	"github.com/rs/zerolog/log"
+)
+
+// upstreamLayerPattern matches the per-layer keys left by stevedore runs on a base image, with or
+// without a project prefix, capturing the layer number
+var upstreamLayerPattern = regexp.MustCompile(`(^|\.)layer\.(\d+)\.`)
+
+// parentImage is the lineage stevedore records for a stage built on an external image
+type parentImage struct {
+	Reference string
+	Digest    string
+	// Labels are the per-layer labels stevedore wrote upstream
+	Labels []labelPair
+	// Warning says why the image could not be looked up
+	Warning string
+}
+
+// fetchParents looks up the base image of each stage built on an external image, fetching each
+// image only once
+func (l *Labeller) fetchParents(stages []*Stage) map[int]*parentImage {
+	parents := make(map[int]*parentImage)
+	fetched := make(map[string]*parentImage)
+
+	for _, stage := range stages {
+		if stage.BaseImage == "" {
+			continue
+		}
+
+		parent, ok := fetched[stage.BaseImage]
+		if !ok {
+			parent = l.fetchParent(stage.BaseImage)
+			fetched[stage.BaseImage] = parent
+		}
+
+		parents[stage.Index] = parent
+	}
+
+	return parents
+}
+
+// inheritLayers numbers each stage's layer after the highest layer recorded upstream, so the
+// labels form an ancestry chain. Stages built on earlier stages follow on from them.
+func inheritLayers(stages []*Stage, parents map[int]*parentImage) {
+	for _, stage := range stages {
+		if stage.Parent != nil {
+			stage.Layer = stage.Parent.Layer + 1
+		} else if parent, ok := parents[stage.Index]; ok {
+			stage.Layer = parent.nextLayer()
+		}
+	}
+}
+
+// fetchParent reads the digest and upstream layer labels of a base image. A registry failure is
+// logged and leaves only the image reference to record.
+func (l *Labeller) fetchParent(image string) *parentImage {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		log.Warn().Err(err).Msgf("cannot inherit labels from %s", image)
+		return &parentImage{Reference: image, Warning: fmt.Sprintf("invalid base image %s: %s", image, err)}
+	}
+
+	// the digest is recorded separately, so the reference reads the same once the FROM is pinned
+	named := ref
+	if named.Tag != "" {
+		named.Digest = ""
+	}
+
+	parent := &parentImage{Reference: named.String()}
+
+	details, err := l.registry.GetImage(ref)
+	if err != nil {
+		log.Warn().Err(err).Msgf("failed to fetch labels for base image %s", ref)
+		parent.Warning = fmt.Sprintf("failed to look up base image %s: %s", ref, err)
+		return parent
+	}
+
+	parent.Digest = l.imageDigest(details)
+
+	for _, key := range sortedKeys(details.Labels) {
+		if upstreamLayerPattern.MatchString(key) {
+			parent.Labels = append(parent.Labels, labelPair{Key: key, Value: details.Labels[key]})
+		}
+	}
+
+	return parent
+}
+
+// imageDigest returns the digest stevedore records for an image: the digest its reference
+// resolves to, or that of the platform's own manifest when a platform was chosen
+func (l *Labeller) imageDigest(details *registry.Image) string {
+	if l.platformSet {
+		return details.PlatformDigest
+	}
+
+	return details.Digest
+}
+
+// nextLayer returns the layer after the highest one recorded upstream
+func (p *parentImage) nextLayer() int64 {
+	var next int64
+
+	for _, pair := range p.Labels {
+		match := upstreamLayerPattern.FindStringSubmatch(pair.Key)
+
+		layer, err := strconv.ParseInt(match[2], 10, 64)
+		if err == nil && layer >= next {
+			next = layer + 1
+		}
+	}
+
+	return next
+}
@@ -0,0 +1,80 @@
+package dockerfile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jameswoolfenden/stevedore/internal/auth"
+	"github.com/jameswoolfenden/stevedore/internal/registry"
+)
+
+// newTestRegistry serves a single image, org/base:1.0, carrying the given config
+func newTestRegistry(t *testing.T, config string) (*httptest.Server, string) {
+	t.Helper()
+
+	configDigest := sha256Digest(config)
+	manifest := `{"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":"` + configDigest + `"}}`
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/org/base/manifests/1.0", "/v2/org/base/manifests/" + sha256Digest(manifest):
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			_, _ = w.Write([]byte(manifest))
+		case "/v2/org/base/blobs/" + configDigest:
+			_, _ = w.Write([]byte(config))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, sha256Digest(manifest)
+}
+
+// sha256Digest returns the digest of content
+func sha256Digest(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestLabeller_Inherit(t *testing.T) {
+	t.Parallel()
+
+	server, digest := newTestRegistry(t, `{"config":{"Labels":{
+		"layer.0.author":"Upstream","layer.0.tool":"stevedore",
+		"layer.1.author":"Middle","maintainer":"someone"}}}`)
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	source := "ARG BASE=" + host + "/org/base:1.0\nFROM ${BASE} AS build\nRUN make\n\nFROM build\nRUN make test\n"
+
+	labeller := NewLabeler(nil, nil)
+	labeller.Inherit = true
+	labeller.Schema = SchemaBoth
+	labeller.registry = registry.NewClient(auth.NewDockerAuthWithClient(server.Client()), server.Client())
+
+	got, err := labeller.Label(parseSource(t, source), "James Woolfenden")
+	if err != nil {
+		t.Fatalf("Label() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`layer.2.author="James Woolfenden"`,
+		`layer.2.parent="` + host + `/org/base:1.0"`,
+		`layer.2.parent.digest="` + digest + `"`,
+		`org.opencontainers.image.base.name="` + host + `/org/base:1.0"`,
+		`layer.0.author="Upstream" layer.0.tool="stevedore" layer.1.author="Middle"`,
+		`layer.3.author="James Woolfenden"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Label() = %q, want it to contain %q", got, want)
+		}
+	}
+
+	if strings.Contains(got, "maintainer") {
+		t.Errorf("Label() = %q, copied a label stevedore did not write upstream", got)
+	}
+}
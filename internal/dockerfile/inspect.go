@@ -0,0 +1,269 @@
+package dockerfile
+
+import (
+	"fmt"
+
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/shell"
+	"github.com/rs/zerolog/log"
+)
+
+// InspectedStage is what a build stage declares, with build arguments and environment variables
+// expanded as a build would see them
+type InspectedStage struct {
+	Path      string          `json:"path" yaml:"path"`
+	Stage     string          `json:"stage" yaml:"stage"`
+	BaseImage string          `json:"baseImage,omitempty" yaml:"baseImage,omitempty"`
+	Labels    []DeclaredLabel `json:"labels" yaml:"labels"`
+	// Parent holds the labels of the base image, when they were asked for
+	Parent map[string]string `json:"parentLabels,omitempty" yaml:"parentLabels,omitempty"`
+}
+
+// DeclaredLabel is a label and the line of the LABEL instruction that sets it
+type DeclaredLabel struct {
+	Key   string `json:"key" yaml:"key"`
+	Value string `json:"value" yaml:"value"`
+	Line  int    `json:"line" yaml:"line"`
+}
+
+// stageEnv tracks the variables visible to the instructions of a stage. Variables set by ENV
+// carry over to stages built on this one and take precedence over build arguments.
+type stageEnv struct {
+	values argEnv
+	vars   argEnv
+}
+
+// Inspect lists the labels each selected stage declares. ARG defaults, overridden by buildArgs,
+// and ENV values are substituted the way the Dockerfile frontend does. With parents set, the
+// labels of each stage's base image are read from its registry as well.
+func (l *Labeller) Inspect(dockerfile *Dockerfile, buildArgs map[string]string, parents bool) ([]InspectedStage, error) {
+	if dockerfile.Parsed == nil {
+		return nil, fmt.Errorf("dockerfile is nil")
+	}
+
+	commands, metaArgs, err := instructions.Parse(dockerfile.Parsed.AST, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse instructions: %w", err)
+	}
+
+	stages := dockerfile.Stages()
+	if len(stages) == 0 || len(commands) != len(stages) {
+		return nil, fmt.Errorf("no FROM instruction found in %s", dockerfile.Path)
+	}
+
+	lex := shell.NewLex(dockerfile.Parsed.EscapeToken)
+
+	global := make(argEnv)
+	for _, arg := range metaArgs {
+		if err := declareArgs(lex, stageEnv{values: global}, arg.Args, buildArgs, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	inspected, err := inspectStages(lex, commands, stages, global, buildArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := l.chooseStages(stages)
+	results := make([]InspectedStage, 0, len(selected))
+	fetched := make(map[string]map[string]string)
+
+	for _, stage := range selected {
+		result := inspected[stage.Index]
+		result.Path = dockerfile.Path
+
+		if parents && stage.Parent == nil && result.BaseImage != "" && result.BaseImage != "scratch" {
+			result.Parent = l.parentLabels(result.BaseImage, fetched)
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// inspectStages inspects every stage in order, so each starts with the environment of the stage
+// it is built on
+func inspectStages(lex *shell.Lex, commands []instructions.Stage, stages []*Stage, global argEnv,
+	buildArgs map[string]string,
+) ([]InspectedStage, error) {
+	envs := make([]argEnv, len(stages))
+	inspected := make([]InspectedStage, len(stages))
+
+	for _, stage := range stages {
+		env := stageEnv{values: make(argEnv), vars: make(argEnv)}
+		if stage.Parent != nil {
+			for key, value := range envs[stage.Parent.Index] {
+				env.set(key, value, true)
+			}
+		}
+
+		result, err := inspectStage(lex, commands[stage.Index], env, global, buildArgs)
+		if err != nil {
+			return nil, fmt.Errorf("stage %s: %w", stage.ID(), err)
+		}
+
+		result.Stage = stage.ID()
+
+		envs[stage.Index] = env.vars
+		inspected[stage.Index] = result
+	}
+
+	return inspected, nil
+}
+
+// inspectStage expands the base image and labels of a stage, following its ARG and ENV
+// instructions in order
+func inspectStage(lex *shell.Lex, stage instructions.Stage, env stageEnv, global argEnv,
+	buildArgs map[string]string,
+) (InspectedStage, error) {
+	result := InspectedStage{Labels: []DeclaredLabel{}}
+
+	base, err := process(lex, stage.BaseName, global)
+	if err != nil {
+		return result, err
+	}
+
+	result.BaseImage = base
+
+	for _, command := range stage.Commands {
+		switch command := command.(type) {
+		case *instructions.ArgCommand:
+			err = declareArgs(lex, env, command.Args, buildArgs, global)
+		case *instructions.EnvCommand:
+			err = setEnv(lex, env, command.Env)
+		case *instructions.LabelCommand:
+			err = result.declare(lex, env, command)
+		}
+
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// declareArgs sets each argument an ARG instruction declares to the build argument given for it,
+// else its default, else the value of the global argument of the same name
+func declareArgs(lex *shell.Lex, env stageEnv, args []instructions.KeyValuePairOptional,
+	buildArgs map[string]string, global argEnv,
+) error {
+	for _, arg := range args {
+		if value, ok := buildArgs[arg.Key]; ok {
+			env.set(arg.Key, value, false)
+			continue
+		}
+
+		if arg.Value != nil {
+			value, err := process(lex, *arg.Value, env.values)
+			if err != nil {
+				return err
+			}
+
+			env.set(arg.Key, value, false)
+			continue
+		}
+
+		if value, ok := global[arg.Key]; ok {
+			env.set(arg.Key, value, false)
+		}
+	}
+
+	return nil
+}
+
+// setEnv sets the variables of an ENV instruction, each expanded against those set before it
+func setEnv(lex *shell.Lex, env stageEnv, pairs instructions.KeyValuePairs) error {
+	for _, pair := range pairs {
+		value, err := process(lex, pair.Value, env.values)
+		if err != nil {
+			return err
+		}
+
+		env.set(pair.Key, value, true)
+	}
+
+	return nil
+}
+
+// set records a variable, where a build argument never replaces an environment variable
+func (e stageEnv) set(key, value string, isEnv bool) {
+	if isEnv {
+		e.vars[key] = value
+	} else if _, ok := e.vars[key]; ok {
+		return
+	}
+
+	e.values[key] = value
+}
+
+// declare records the labels of a LABEL instruction, a later declaration of a key replacing
+// an earlier one
+func (r *InspectedStage) declare(lex *shell.Lex, env stageEnv, command *instructions.LabelCommand) error {
+	var line int
+	if location := command.Location(); len(location) > 0 {
+		line = location[0].Start.Line
+	}
+
+	for _, pair := range command.Labels {
+		key, err := process(lex, pair.Key, env.values)
+		if err != nil {
+			return err
+		}
+
+		value, err := process(lex, pair.Value, env.values)
+		if err != nil {
+			return err
+		}
+
+		label := DeclaredLabel{Key: key, Value: value, Line: line}
+
+		replaced := false
+		for i := range r.Labels {
+			if r.Labels[i].Key == key {
+				r.Labels[i], replaced = label, true
+			}
+		}
+
+		if !replaced {
+			r.Labels = append(r.Labels, label)
+		}
+	}
+
+	return nil
+}
+
+// parentLabels reads the labels of a base image, fetching each image once. A registry failure
+// is logged and leaves the image without labels.
+func (l *Labeller) parentLabels(image string, fetched map[string]map[string]string) map[string]string {
+	if labels, ok := fetched[image]; ok {
+		return labels
+	}
+
+	labels := make(map[string]string)
+	fetched[image] = labels
+
+	parentLabels, err := l.GetDockerLabels(&Dockerfile{Image: image})
+	if err != nil {
+		log.Warn().Err(err).Msgf("failed to fetch labels for base image %s", image)
+		return labels
+	}
+
+	for key, value := range parentLabels {
+		labels[key] = fmt.Sprint(value)
+	}
+
+	return labels
+}
+
+// process expands a word against the variables in scope
+func process(lex *shell.Lex, word string, env argEnv) (string, error) {
+	result, _, err := lex.ProcessWord(word, env)
+	if err != nil {
+		return "", fmt.Errorf("failed to expand %s: %w", word, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,119 @@
+package dockerfile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jameswoolfenden/stevedore/internal/auth"
+	"github.com/jameswoolfenden/stevedore/internal/registry"
+)
+
+func TestLabeller_Inspect(t *testing.T) {
+	t.Parallel()
+
+	source := `ARG VERSION=1.0
+ARG BASE=alpine:3.20
+FROM ${BASE} AS base
+ENV TEAM=platform
+ARG VERSION
+LABEL version="${VERSION}" team=$TEAM \
+      description="built from ${BASE}"
+
+FROM base
+ARG REVISION=dev
+LABEL team="${TEAM}-app" revision=$REVISION
+LABEL revision="${REVISION}-final"
+`
+
+	tests := []struct {
+		name      string
+		stages    []string
+		buildArgs map[string]string
+		want      []InspectedStage
+	}{
+		{
+			"defaults",
+			nil,
+			nil,
+			[]InspectedStage{
+				{Path: "Dockerfile", Stage: "base", BaseImage: "alpine:3.20", Labels: []DeclaredLabel{
+					{Key: "version", Value: "1.0", Line: 6},
+					{Key: "team", Value: "platform", Line: 6},
+					{Key: "description", Value: "built from ", Line: 6},
+				}},
+				{Path: "Dockerfile", Stage: "1", BaseImage: "base", Labels: []DeclaredLabel{
+					{Key: "team", Value: "platform-app", Line: 11},
+					{Key: "revision", Value: "dev-final", Line: 12},
+				}},
+			},
+		},
+		{
+			"build args",
+			[]string{"final"},
+			map[string]string{"REVISION": "abc123", "BASE": "debian"},
+			[]InspectedStage{
+				{Path: "Dockerfile", Stage: "1", BaseImage: "base", Labels: []DeclaredLabel{
+					{Key: "team", Value: "platform-app", Line: 11},
+					{Key: "revision", Value: "abc123-final", Line: 12},
+				}},
+			},
+		},
+		{
+			"global override",
+			[]string{"base"},
+			map[string]string{"VERSION": "2.0", "BASE": "debian"},
+			[]InspectedStage{
+				{Path: "Dockerfile", Stage: "base", BaseImage: "debian", Labels: []DeclaredLabel{
+					{Key: "version", Value: "2.0", Line: 6},
+					{Key: "team", Value: "platform", Line: 6},
+					{Key: "description", Value: "built from ", Line: 6},
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			labeller := NewLabeler(nil, nil)
+			labeller.Stages = tt.stages
+
+			got, err := labeller.Inspect(parseSource(t, source), tt.buildArgs, false)
+			if err != nil {
+				t.Fatalf("Inspect() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Inspect() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabeller_InspectParents(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestRegistry(t, `{"config":{"Labels":{"maintainer":"someone","layer.0.author":"Upstream"}}}`)
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	labeller := NewLabeler(nil, nil)
+	labeller.registry = registry.NewClient(auth.NewDockerAuthWithClient(server.Client()), server.Client())
+
+	source := "FROM " + host + "/org/base:1.0 AS build\nLABEL a=b\n\nFROM build\nLABEL c=d\n"
+
+	got, err := labeller.Inspect(parseSource(t, source), nil, true)
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+
+	want := map[string]string{"maintainer": "someone", "layer.0.author": "Upstream"}
+	if !reflect.DeepEqual(got[0].Parent, want) {
+		t.Errorf("Inspect() parent labels = %v, want %v", got[0].Parent, want)
+	}
+
+	if got[1].Parent != nil {
+		t.Errorf("Inspect() parent labels of a stage built on a stage = %v, want none", got[1].Parent)
+	}
+}
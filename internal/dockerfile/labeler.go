@@ -1,32 +1,33 @@
 package dockerfile
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"os/user"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jameswoolfenden/stevedore/internal/auth"
+	"github.com/jameswoolfenden/stevedore/internal/ci"
 	"github.com/jameswoolfenden/stevedore/internal/config"
 	"github.com/jameswoolfenden/stevedore/internal/git"
+	"github.com/jameswoolfenden/stevedore/internal/registry"
 	"github.com/moby/buildkit/frontend/dockerfile/parser"
 	"github.com/rs/zerolog/log"
 )
 
-const dockerRegistryURL = "https://registry-1.docker.io/v2/"
-
 // Dockerfile represents a parsed Dockerfile with metadata
 type Dockerfile struct {
 	Parsed *parser.Result
 	Path   string
 	Image  string
+	Source []byte
 }
 
 // Labeller handles adding labels to Dockerfiles
@@ -34,261 +35,552 @@ type Labeller struct {
 	gitService  git.Service
 	authService auth.DockerAuth
 	httpClient  *http.Client
+	registry    *registry.Client
+
+	// Stages selects which build stages are labelled, by name or index; empty labels them all
+	Stages []string
+	// Schema selects the label keys written, legacy stevedore keys by default
+	Schema Schema
+	// Licenses is the SPDX license expression recorded by the OCI schema
+	Licenses string
+	// Project holds the keys, prefix and extra labels declared in .stevedore.yaml
+	Project *config.Project
+	// Inherit records each stage's base image and the layers stevedore labelled upstream
+	Inherit bool
+	// PinDigests rewrites each FROM to include the digest its tag currently resolves to
+	PinDigests bool
+	// Blame records who introduced each stage's FROM and who last changed the stage, from git blame
+	Blame bool
+	// CI is what the CI provider reports about the run, filling in what git cannot tell
+	CI *ci.Info
+
+	platformSet bool
+
+	stagesMu sync.Mutex
+	// matchedStages holds the Stages ids that matched a stage in the files processed so far
+	matchedStages map[string]bool
+
+	dirtyOnce sync.Once
+	dirty     bool
+	dirtyErr  error
+	// dockerfiles holds the absolute paths of the files this run scans
+	dockerfiles map[string]bool
+
+	identityOnce    sync.Once
+	defaultIdentity git.Identity
 }
 
 // NewLabeler creates a new Labeler instance
 func NewLabeler(gitService git.Service, authService auth.DockerAuth) *Labeller {
+	httpClient := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
 	return &Labeller{
 		gitService:  gitService,
 		authService: authService,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		httpClient:  httpClient,
+		registry:    registry.NewClient(authService, httpClient),
+		Schema:      SchemaLegacy,
 	}
 }
 
+// SetHTTPTimeout changes the timeout used for registry requests
+func (l *Labeller) SetHTTPTimeout(timeout time.Duration) {
+	l.httpClient.Timeout = timeout
+}
+
+// SetPlatform chooses the platform read from multi-arch base images, which also makes pinned and
+// recorded digests refer to that platform's manifest rather than the index
+func (l *Labeller) SetPlatform(platform registry.Platform) {
+	l.registry.Platform = platform
+	l.platformSet = true
+}
+
+// UseCache keeps registry manifests and config blobs in the disk cache, and in offline mode
+// answers every registry lookup from it
+func (l *Labeller) UseCache(cache *registry.Cache, offline bool) {
+	l.registry.Cache = cache
+	l.registry.Offline = offline
+}
+
 // ParseFile opens and parses a Dockerfile
 func (d *Dockerfile) ParseFile() error {
 	if err := config.ValidateDockerfilePath(d.Path); err != nil {
 		return err
 	}
 
-	data, err := os.Open(d.Path)
+	log.Info().Msgf("opening: %s", d.Path)
+
+	data, err := os.ReadFile(d.Path)
 	if err != nil {
 		return fmt.Errorf("failed to open file %s: %w", d.Path, err)
 	}
 
-	defer func() {
-		if closeErr := data.Close(); closeErr != nil {
-			log.Warn().Err(closeErr).Msgf("failed to close file: %s", d.Path)
-		}
-	}()
-
-	log.Info().Msgf("opening: %s", d.Path)
-
-	d.Parsed, err = parser.Parse(data)
+	d.Parsed, err = parser.Parse(bytes.NewReader(data))
 	if err != nil {
 		return fmt.Errorf("failed to parse dockerfile: %w", err)
 	}
 
+	d.Source = data
+
+	if d.Image == "" {
+		d.Image = d.BaseImage()
+	}
+
 	return nil
 }
 
-// Label adds metadata labels to the Dockerfile
+// source returns the original bytes of the Dockerfile, reading them from disk when it was parsed elsewhere
+func (d *Dockerfile) source() ([]byte, error) {
+	if d.Source != nil {
+		return d.Source, nil
+	}
+
+	data, err := os.ReadFile(d.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", d.Path, err)
+	}
+
+	d.Source = data
+
+	return data, nil
+}
+
+// Label adds metadata labels to each selected build stage of the Dockerfile
 func (l *Labeller) Label(dockerfile *Dockerfile, authorOverride string) (string, error) {
+	dump, _, err := l.label(dockerfile, authorOverride)
+
+	return dump, err
+}
+
+// label adds the labels and reports the changes made to each stage, and anything that stopped
+// stevedore recording all it could
+func (l *Labeller) label(dockerfile *Dockerfile, authorOverride string) (string, FileReport, error) {
+	report := FileReport{Path: dockerfile.Path}
+
 	if dockerfile.Parsed == nil {
-		return "", fmt.Errorf("dockerfile is nil")
+		return "", report, fmt.Errorf("dockerfile is nil")
 	}
 
-	var label *parser.Node
-	var endLine int
-	var layer int64
+	source, err := dockerfile.source()
+	if err != nil {
+		return "", report, err
+	}
+
+	stages, parents, err := l.prepareStages(dockerfile)
+	if err != nil {
+		return "", report, err
+	}
+
+	myUser := l.currentUser(authorOverride)
+	selected := l.chooseStages(stages)
+
+	var edits []edit
+
+	for _, stage := range selected {
+		desired, warnings := l.desiredLabels(stage, myUser, dockerfile.Path, len(stages) > 1, parents[stage.Index])
+		report.warn(warnings...)
+
+		if parent := parents[stage.Index]; parent != nil {
+			report.warn(parent.Warning)
+		}
+
+		log.Info().Msgf("file: %s", dockerfile.Path)
+		log.Info().Msgf("label: %s", renderLabel(desired))
+
+		edits = append(edits, labelStage(source, stage, desired)...)
+
+		if l.PinDigests {
+			edits = append(edits, pinStage(source, stage, parents[stage.Index])...)
+		}
+	}
+
+	dump := applyEdits(source, edits)
+
+	report.Changed = dump != string(source)
+	if report.Stages, err = stageReports(selected, parents, dump); err != nil {
+		return "", report, err
+	}
+
+	return dump, report, nil
+}
+
+// prepareStages splits the Dockerfile into its build stages and, when inheriting or pinning,
+// looks up the base image of each one
+func (l *Labeller) prepareStages(dockerfile *Dockerfile) ([]*Stage, map[int]*parentImage, error) {
+	stages := dockerfile.Stages()
+	if len(stages) == 0 {
+		return nil, nil, fmt.Errorf("no FROM instruction found in %s", dockerfile.Path)
+	}
+
+	if dockerfile.Image == "" {
+		dockerfile.Image = dockerfile.BaseImage()
+	}
+
+	if !l.Inherit && !l.PinDigests {
+		return stages, nil, nil
+	}
+
+	parents := l.fetchParents(stages)
+	if l.Inherit {
+		inheritLayers(stages, parents)
+	}
+
+	return stages, parents, nil
+}
+
+// labelStage updates the first LABEL in a stage holding stevedore keys, strips duplicates from any others,
+// or adds a new LABEL at the end of the stage
+func labelStage(source []byte, stage *Stage, desired []labelPair) []edit {
+	desired = keepVolatileValues(stage.Labels(), desired)
+
+	var edits []edit
+	var updated bool
+
+	for _, child := range stage.Nodes {
+		if !isLabelNode(child) || !hasOwnedKeys(labelPairs(child), desired) {
+			continue
+		}
+
+		existing := labelPairs(child)
+
+		var pairs []labelPair
+		if updated {
+			pairs = stripLabels(existing, desired)
+		} else {
+			pairs = mergeLabels(existing, desired)
+			updated = true
+		}
+
+		text := ""
+		if len(pairs) > 0 {
+			text = rewriteLabel(source, child, existing, pairs)
+		}
+
+		edits = append(edits, edit{node: child, text: text})
+	}
+
+	if !updated {
+		edits = append(edits, edit{node: stage.Last(), text: renderLabel(desired), insert: true})
+	}
+
+	return edits
+}
+
+// currentUser resolves the author for this run: the override when one is given, else the git
+// identity, else the operating system user
+func (l *Labeller) currentUser(authorOverride string) *user.User {
+	if authorOverride != "" && authorOverride != "." {
+		return &user.User{Name: authorOverride}
+	}
+
+	if name := l.identity().Name; name != "" {
+		return &user.User{Name: name}
+	}
 
-	// Get author information
 	myUser, err := user.Current()
 	if err != nil {
 		log.Warn().Err(err).Msg("failed to get current user, using default")
 		myUser = &user.User{Name: "unknown"}
 	}
 
-	if authorOverride != "" && authorOverride != "." {
-		myUser.Name = authorOverride
+	return myUser
+}
+
+// identity returns who git would record as the author, from the repository's config when there
+// is one and otherwise the user's own, read once
+func (l *Labeller) identity() git.Identity {
+	if l.gitService != nil {
+		return git.Identity{Name: l.gitService.GetCurrentUserName(), Email: l.gitService.GetCurrentUserEmail()}
 	}
 
-	// Process AST nodes to find or create LABEL instruction
-	for _, child := range dockerfile.Parsed.AST.Children {
-		endLine = child.EndLine
+	l.identityOnce.Do(func() {
+		l.defaultIdentity = git.DefaultIdentity()
+	})
 
-		if strings.Contains(child.Value, "LABEL") {
-			label = l.makeLabel(child, layer, myUser, endLine, dockerfile.Path)
+	return l.defaultIdentity
+}
+
+// desiredLabels builds the labels stevedore writes for a build stage, with warnings about the
+// metadata it could not collect
+func (l *Labeller) desiredLabels(stage *Stage, myUser *user.User, filePath string, multiStage bool,
+	parent *parentImage,
+) ([]labelPair, []string) {
+	meta := l.collectMetadata(myUser, filePath)
+
+	if parent != nil {
+		meta.BaseName = parent.Reference
+		meta.BaseDigest = parent.Digest
+	}
+
+	var desired []labelPair
+
+	if l.Schema != SchemaOCI {
+		desired = append(desired, makeLabel(stage.Layer, meta)...)
+		if multiStage {
+			desired = append(desired, labelPair{Key: layerKey(stage.Layer, "stage"), Value: stage.ID()})
 		}
 	}
 
-	// Create new label if none exists
-	if label == nil {
-		var newLabel parser.Node
-		l.makeLabel(&newLabel, layer, myUser, endLine, dockerfile.Path)
-		dockerfile.Parsed.AST.Children = append(dockerfile.Parsed.AST.Children, &newLabel)
+	if l.Schema == SchemaOCI || l.Schema == SchemaBoth {
+		desired = append(desired, ociLabels(meta, l.Licenses)...)
 	}
 
-	// Build output from AST
-	var dump strings.Builder
-	for _, child := range dockerfile.Parsed.AST.Children {
-		dump.WriteString(child.Original)
-		dump.WriteString("\n")
+	if meta.BuildURL != "" {
+		desired = append(desired, labelPair{Key: buildURLKey, Value: meta.BuildURL})
 	}
 
-	return dump.String(), nil
-}
+	if l.Blame {
+		pairs, warning := l.blameLabels(stage, filePath)
+		desired = append(desired, pairs...)
+
+		if warning != "" {
+			meta.Warnings = append(meta.Warnings, warning)
+		}
+	}
 
-// makeLabel creates a label node with metadata
-func (l *Labeller) makeLabel(child *parser.Node, layer int64, myUser *user.User, endLine int, filePath string) *parser.Node {
-	myLayer := " layer." + strconv.FormatInt(layer, 10)
+	desired = applyProject(l.Project, desired, stage, meta)
 
-	// Build base label
-	if strings.Contains(child.Value, "LABEL") {
-		child.Original = child.Original + myLayer +
-			".author=" + "\"" + myUser.Name + "\"" + myLayer + ".trace=\"" + uuid.NewString() + "\""
-	} else {
-		child.Original = "LABEL" + myLayer +
-			".author=" + "\"" + myUser.Name + "\"" + myLayer + ".trace=\"" + uuid.NewString() + "\""
+	// upstream labels keep the keys they were written with
+	if parent != nil && l.Inherit {
+		desired = append(desired, parent.Labels...)
 	}
 
-	child.Original += myLayer + ".tool=\"stevedore\""
-	child.StartLine = endLine + 1
-	child.EndLine = endLine + 1
+	return desired, meta.Warnings
+}
+
+// metadata is the information stevedore records about a Dockerfile
+type metadata struct {
+	Author  string
+	Email   string
+	Trace   string
+	Created string
+	HasGit  bool
+	Repo    string
+	Org     string
+	File    string
+	Commit  string
+	Source  string
+	// Branch is empty when HEAD is detached and Tag when no tag points at HEAD
+	Branch string
+	Tag    string
+	// Worktree is set when the dirty flags were read from a git working tree
+	Worktree bool
+	// Dirty is set when the working tree has uncommitted changes, FileDirty when the Dockerfile does
+	Dirty      bool
+	FileDirty  bool
+	CommitTime string
+	// LastCommit is the most recent commit to change the Dockerfile
+	LastCommit string
+	// BuildProvider, BuildID and BuildURL identify the CI pipeline run
+	BuildProvider string
+	BuildID       string
+	BuildURL      string
+	// BaseName and BaseDigest identify the base image when labels are inherited
+	BaseName   string
+	BaseDigest string
+	// Warnings describe the metadata that could not be collected
+	Warnings []string
+}
+
+// collectMetadata gathers the author and, when available, git details for a Dockerfile
+func (l *Labeller) collectMetadata(myUser *user.User, filePath string) metadata {
+	meta := metadata{
+		Author:  myUser.Name,
+		Email:   l.identity().Email,
+		Trace:   uuid.NewString(),
+		Created: time.Now().UTC().Format(time.RFC3339),
+	}
 
 	// Add git metadata if available
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
 		log.Warn().Err(err).Msgf("failed to get absolute path for %s", filePath)
-		return child
+		meta.Warnings = append(meta.Warnings, fmt.Sprintf("failed to get absolute path: %s", err))
+		return meta
 	}
 
 	if l.gitService != nil {
-		l.addGitMetadata(child, absPath)
-	} else {
-		log.Debug().Msg("git service not available, skipping git metadata")
+		l.addGitMetadata(&meta, absPath)
 	}
 
-	log.Info().Msgf("file: %s", filePath)
-	log.Info().Msgf("label: %s", child.Original)
+	if l.CI != nil {
+		addCIMetadata(&meta, l.CI, absPath)
+	}
 
-	return child
+	if l.gitService == nil && !meta.HasGit {
+		log.Debug().Msg("git service not available, skipping git metadata")
+		meta.Warnings = append(meta.Warnings, "git metadata unavailable: not in a git repository")
+	}
+
+	return meta
 }
 
-// addGitMetadata adds git-related metadata to the label
-func (l *Labeller) addGitMetadata(child *parser.Node, absPath string) {
+// addGitMetadata adds git-related metadata
+func (l *Labeller) addGitMetadata(meta *metadata, absPath string) {
 	// Get commit hash from the existing repository (not cloning!)
 	hash, err := l.gitService.GetCommitHash()
 	if err != nil {
 		log.Warn().Err(err).Msg("failed to get git commit hash")
+		meta.Warnings = append(meta.Warnings, fmt.Sprintf("git metadata unavailable: %s", err))
 		return
 	}
 
 	relPath, err := l.gitService.GetRelativePath(absPath)
 	if err != nil {
 		log.Warn().Err(err).Msg("failed to get relative path")
+		meta.Warnings = append(meta.Warnings, fmt.Sprintf("failed to get path in git repository: %s", err))
 		relPath = filepath.Base(absPath)
 	}
 
-	child.Original += " git_repo=" + "\"" + l.gitService.GetRepoName() + "\""
-	child.Original += " git_org=" + "\"" + l.gitService.GetOrganization() + "\""
-	child.Original += " git_file=" + "\"" + relPath + "\""
-	child.Original += " git_commit=" + "\"" + hash + "\""
-}
+	meta.HasGit = true
+	meta.Repo = l.gitService.GetRepoName()
+	meta.Org = l.gitService.GetOrganization()
+	meta.File = filepath.ToSlash(relPath)
+	meta.Commit = hash
+	meta.Source = git.SourceURL(l.gitService.GetRemoteURL())
+	meta.Branch = l.gitService.GetBranch()
+	meta.Tag = l.gitService.GetTag()
+	meta.Worktree = true
+	meta.FileDirty = l.fileDirty(absPath)
+
+	if commitTime, err := l.gitService.GetCommitTime(); err == nil {
+		meta.CommitTime = commitTime.UTC().Format(time.RFC3339)
+	} else {
+		meta.Warnings = append(meta.Warnings, fmt.Sprintf("failed to get commit time: %s", err))
+	}
 
-// GetDockerLabels retrieves labels from a parent Docker image
-func (l *Labeller) GetDockerLabels(dockerfile *Dockerfile) (map[string]interface{}, error) {
-	version := "latest"
-	image := dockerfile.Image
+	if dirty, err := l.treeDirty(); err == nil {
+		meta.Dirty = dirty
+	} else {
+		log.Warn().Err(err).Msg("failed to get working tree status")
+		meta.Warnings = append(meta.Warnings, fmt.Sprintf("failed to get working tree status: %s", err))
+	}
 
-	// Normalize image name
-	splitter := strings.SplitN(image, "/", 2)
-	if len(splitter) < 2 {
-		image = "library/" + image
+	if lastCommit, err := l.gitService.GetLastCommit(absPath); err == nil {
+		meta.LastCommit = lastCommit
+	} else {
+		log.Debug().Err(err).Msgf("no commit found for %s", absPath)
+		meta.Warnings = append(meta.Warnings, fmt.Sprintf("%s has not been committed", meta.File))
 	}
+}
+
+// addCIMetadata fills in what git could not tell from the CI provider's variables. CI checkouts
+// are often shallow or detached, have no remote called origin, or no git at all, in which case
+// the commit and repository come from the provider alone.
+func addCIMetadata(meta *metadata, info *ci.Info, absPath string) {
+	meta.BuildProvider = info.Provider
+	meta.BuildID = info.RunID
+	meta.BuildURL = info.RunURL
+
+	if !meta.HasGit {
+		if info.Commit == "" {
+			return
+		}
 
-	// Extract version if specified
-	splitterVersion := strings.SplitN(image, ":", 2)
-	if len(splitterVersion) == 2 {
-		version = splitterVersion[1]
-		image = splitterVersion[0]
+		meta.HasGit = true
+		meta.Commit = info.Commit
+		meta.File = workspacePath(info.Workspace, absPath)
 	}
 
-	// Get authentication token
-	token, err := l.authService.GetAuthToken(image)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get auth token: %w", err)
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
 	}
 
-	// Fetch parent labels
-	parentLabels, err := l.getParentLabels(image, version, token)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get parent labels for %s: %w", image, err)
+	fill(&meta.Repo, info.Repo)
+	fill(&meta.Org, info.Org)
+	fill(&meta.Source, git.SourceURL(info.RemoteURL))
+	fill(&meta.Email, info.Email)
+
+	// a tag build checks out a detached HEAD, so only take the provider's branch when git has no tag either
+	if meta.Branch == "" && meta.Tag == "" {
+		meta.Branch = info.Branch
 	}
 
-	return parentLabels, nil
+	fill(&meta.Tag, info.Tag)
 }
 
-// getParentLabels fetches labels from the Docker registry manifest
-func (l *Labeller) getParentLabels(image, version, token string) (map[string]interface{}, error) {
-	url := dockerRegistryURL + image + "/manifests/" + version
+// workspacePath returns the path of a file relative to the CI workspace, or the working directory
+// when there is none, falling back to its base name when it lies outside
+func workspacePath(workspace, absPath string) string {
+	if workspace == "" {
+		workspace, _ = os.Getwd()
+	}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	rel, err := filepath.Rel(workspace, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Base(absPath)
 	}
 
-	// Set accept headers for different manifest formats
-	req.Header.Add("accept", "application/vnd.oci.image.index.v1+json")
-	req.Header.Add("accept", "application/vnd.oci.image.manifest.v1+json")
-	req.Header.Add("accept", "application/vnd.docker.distribution.manifest.v2+json")
-	req.Header.Add("accept", "application/vnd.docker.distribution.manifest.list.v2+json")
-	req.Header.Add("accept", "application/json")
-	req.Header.Add("content-type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+token)
+	return filepath.ToSlash(rel)
+}
 
-	res, err := l.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute http request: %w", err)
+// makeLabel builds the legacy label pairs stevedore owns for a layer
+func makeLabel(layer int64, meta metadata) []labelPair {
+	pairs := []labelPair{
+		{Key: layerKey(layer, "author"), Value: meta.Author},
+		{Key: layerKey(layer, "trace"), Value: meta.Trace},
+		{Key: layerKey(layer, "tool"), Value: "stevedore"},
 	}
 
-	defer func() {
-		if closeErr := res.Body.Close(); closeErr != nil {
-			log.Warn().Err(closeErr).Msg("failed to close http response body")
-		}
-	}()
+	if meta.BaseName != "" {
+		pairs = append(pairs, labelPair{Key: layerKey(layer, "parent"), Value: meta.BaseName})
+	}
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+	if meta.BaseDigest != "" {
+		pairs = append(pairs, labelPair{Key: layerKey(layer, "parent.digest"), Value: meta.BaseDigest})
 	}
 
-	var parentContainer map[string]interface{}
-	if err := json.Unmarshal(body, &parentContainer); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	if !meta.HasGit {
+		return pairs
 	}
 
-	log.Debug().Interface("parent_container", parentContainer).Msg("fetched parent container manifest")
+	pairs = append(pairs,
+		labelPair{Key: "git_repo", Value: meta.Repo},
+		labelPair{Key: "git_org", Value: meta.Org},
+		labelPair{Key: "git_file", Value: meta.File},
+		labelPair{Key: "git_commit", Value: meta.Commit},
+	)
 
-	// Extract labels from history
-	history, ok := parentContainer["history"].([]interface{})
-	if !ok {
-		log.Debug().Msg("no history entry in parent container")
-		return nil, nil
+	if meta.Branch != "" {
+		pairs = append(pairs, labelPair{Key: "git_branch", Value: meta.Branch})
 	}
 
-	if len(history) == 0 {
-		return nil, nil
+	if meta.Tag != "" {
+		pairs = append(pairs, labelPair{Key: "git_tag", Value: meta.Tag})
 	}
 
-	temp, ok := history[0].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("history entry is not map[string]interface{}")
+	if meta.CommitTime != "" {
+		pairs = append(pairs, labelPair{Key: "git_commit_time", Value: meta.CommitTime})
 	}
 
-	previous, ok := temp["v1Compatibility"].(string)
-	if !ok {
-		log.Debug().Msg("no v1Compatibility in history")
-		return nil, nil
+	if meta.LastCommit != "" {
+		pairs = append(pairs, labelPair{Key: "git_last_commit", Value: meta.LastCommit})
 	}
 
-	var parent map[string]interface{}
-	if err := json.Unmarshal([]byte(previous), &parent); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal v1Compatibility: %w", err)
+	if !meta.Worktree {
+		return pairs
 	}
 
-	config, ok := parent["container_config"].(map[string]interface{})
-	if !ok {
-		log.Debug().Msg("no container_config in parent")
-		return nil, nil
+	return append(pairs,
+		labelPair{Key: "git_dirty", Value: strconv.FormatBool(meta.Dirty)},
+		labelPair{Key: "git_file_dirty", Value: strconv.FormatBool(meta.FileDirty)},
+	)
+}
+
+// GetDockerLabels retrieves labels from a parent Docker image, on Docker Hub or any other registry
+func (l *Labeller) GetDockerLabels(dockerfile *Dockerfile) (map[string]interface{}, error) {
+	ref, err := registry.ParseReference(dockerfile.Image)
+	if err != nil {
+		return nil, err
 	}
 
-	parentLabels, ok := config["Labels"].(map[string]interface{})
-	if !ok {
-		log.Debug().Msg("no labels in container_config")
-		return nil, nil
+	parentLabels, err := l.registry.GetLabels(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parent labels for %s: %w", ref, err)
 	}
 
 	return parentLabels, nil
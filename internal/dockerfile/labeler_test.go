@@ -0,0 +1,169 @@
+package dockerfile
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jameswoolfenden/stevedore/internal/ci"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+func parseSource(t *testing.T, source string) *Dockerfile {
+	t.Helper()
+
+	parsed, err := parser.Parse(bytes.NewReader([]byte(source)))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	return &Dockerfile{Parsed: parsed, Path: "Dockerfile", Source: []byte(source)}
+}
+
+func TestLabeller_Label(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{
+			"preserves comments",
+			"# syntax=docker/dockerfile:1\n\nFROM alpine\n\n# run it\nENTRYPOINT [\"/entrypoint.sh\"]\n",
+			[]string{"# syntax=docker/dockerfile:1\n\nFROM alpine\n\n# run it\nENTRYPOINT [\"/entrypoint.sh\"]\nLABEL layer.0.author=\"James Woolfenden\""},
+		},
+		{
+			"no trailing newline",
+			"FROM alpine\nRUN echo",
+			[]string{"FROM alpine\nRUN echo\nLABEL layer.0.author=\"James Woolfenden\""},
+		},
+		{
+			"multi-stage",
+			"FROM golang AS builder\nRUN <<EOF\nmake\nEOF\n\nFROM alpine\nCOPY --from=builder /app /app\n",
+			[]string{
+				"EOF\nLABEL layer.0.author=\"James Woolfenden\"",
+				"layer.0.stage=\"builder\"\n\nFROM alpine\nCOPY --from=builder /app /app\nLABEL layer.0.author",
+				"layer.0.stage=\"1\"\n",
+			},
+		},
+		{
+			"updates in place",
+			"FROM alpine\nLABEL a=b \\\n  layer.0.author=\"someone\"\nRUN echo\n",
+			[]string{"FROM alpine\nLABEL a=b \\\n  layer.0.author=\"James Woolfenden\" \\\n  layer.0.trace="},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			labeller := NewLabeler(nil, nil)
+
+			got, err := labeller.Label(parseSource(t, tt.source), "James Woolfenden")
+			if err != nil {
+				t.Fatalf("Label() error = %v", err)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("Label() = %q, want it to contain %q", got, want)
+				}
+			}
+
+			again, err := labeller.Label(parseSource(t, got), "James Woolfenden")
+			if err != nil {
+				t.Fatalf("Label() second run error = %v", err)
+			}
+
+			if again != got {
+				t.Errorf("Label() is not idempotent, first %q, second %q", got, again)
+			}
+		})
+	}
+}
+
+func TestLabeller_LabelKeepsLayout(t *testing.T) {
+	t.Parallel()
+
+	source := "FROM alpine\n" +
+		"LABEL org.opencontainers.image.title=\"app\" \\\n" +
+		"      org.opencontainers.image.authors=\"someone\" \\\n" +
+		"      org.opencontainers.image.description=\"an app\"\n"
+
+	labeller := NewLabeler(nil, nil)
+	labeller.Schema = SchemaOCI
+
+	got, err := labeller.Label(parseSource(t, source), "James Woolfenden")
+	if err != nil {
+		t.Fatalf("Label() error = %v", err)
+	}
+
+	want := "FROM alpine\n" +
+		"LABEL org.opencontainers.image.title=\"app\" \\\n" +
+		"      org.opencontainers.image.authors=\"James Woolfenden\" \\\n" +
+		"      org.opencontainers.image.description=\"an app\" \\\n" +
+		"      org.opencontainers.image.created="
+
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("Label() = %q, want the lines kept and the new label on a line of its own", got)
+	}
+}
+
+func TestAddCIMetadata(t *testing.T) {
+	t.Parallel()
+
+	info := &ci.Info{
+		Provider:  "github-actions",
+		Org:       "acme",
+		Repo:      "widget",
+		RemoteURL: "https://github.com/acme/widget",
+		Commit:    "abc123",
+		Branch:    "main",
+		RunID:     "42",
+		RunURL:    "https://github.com/acme/widget/actions/runs/42",
+		Workspace: filepath.FromSlash("/work/widget"),
+	}
+	absPath := filepath.FromSlash("/work/widget/build/Dockerfile")
+
+	tests := []struct {
+		name string
+		meta metadata
+		want metadata
+	}{
+		{"no git", metadata{}, metadata{
+			HasGit: true, Commit: "abc123", File: "build/Dockerfile", Repo: "widget", Org: "acme",
+			Source: "https://github.com/acme/widget", Branch: "main",
+			BuildProvider: "github-actions", BuildID: "42", BuildURL: info.RunURL,
+		}},
+		{"detached without origin", metadata{HasGit: true, Commit: "def456", File: "Dockerfile"}, metadata{
+			HasGit: true, Commit: "def456", File: "Dockerfile", Repo: "widget", Org: "acme",
+			Source: "https://github.com/acme/widget", Branch: "main",
+			BuildProvider: "github-actions", BuildID: "42", BuildURL: info.RunURL,
+		}},
+		{"git wins", metadata{
+			HasGit: true, Commit: "def456", File: "Dockerfile", Repo: "gadget", Org: "corp",
+			Source: "https://example.com/corp/gadget", Tag: "v1.0.0",
+		}, metadata{
+			HasGit: true, Commit: "def456", File: "Dockerfile", Repo: "gadget", Org: "corp",
+			Source: "https://example.com/corp/gadget", Tag: "v1.0.0",
+			BuildProvider: "github-actions", BuildID: "42", BuildURL: info.RunURL,
+		}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := tt.meta
+			addCIMetadata(&got, info, absPath)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("addCIMetadata() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
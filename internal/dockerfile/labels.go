@@ -0,0 +1,378 @@
+package dockerfile
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// buildURLKey records the CI pipeline run that labelled the Dockerfile
+const buildURLKey = "build.url"
+
+// ownedKeyPattern matches the label keys that only stevedore writes, so it may always replace them
+var ownedKeyPattern = regexp.MustCompile(`^(layer\.\d+\.(author|trace|tool|stage|parent|parent\.digest|(from|changed)\.(author|commit))|git_(repo|org|file|commit|branch|tag|dirty|file_dirty|commit_time|last_commit)|build\.url)$`)
+
+// ociKeyPattern matches the OCI keys stevedore writes. Users write them too, so they are only
+// stevedore's in a LABEL that carries its tool marker.
+var ociKeyPattern = regexp.MustCompile(`^org\.opencontainers\.image\.(source|revision|version|authors|created|title|vendor|licenses|base\.name|base\.digest)$`)
+
+// toolKeyPattern matches the key stevedore marks its labels with, with or without a project prefix
+var toolKeyPattern = regexp.MustCompile(`(^|\.)layer\.\d+\.tool$`)
+
+// volatileKeyPattern matches owned keys whose values change on every run, with or without a project prefix
+var volatileKeyPattern = regexp.MustCompile(`(^|\.)(layer\.\d+\.trace|org\.opencontainers\.image\.created|build\.url)$`)
+
+// headKeyPattern matches owned keys that record the commit the labels were written at. Committing
+// the labels moves HEAD past that commit, so their values are not compared with the current HEAD.
+var headKeyPattern = regexp.MustCompile(`(^|\.)(git_commit|git_commit_time|git_last_commit|org\.opencontainers\.image\.revision)$`)
+
+// labelPair is a single key/value pair declared by a LABEL instruction
+type labelPair struct {
+	Key   string
+	Value string
+	raw   string
+}
+
+// layerKey builds the key for a per-layer label
+func layerKey(layer int64, name string) string {
+	return "layer." + strconv.FormatInt(layer, 10) + "." + name
+}
+
+// isOwnedKey reports whether stevedore manages the given label key, either because it is one of
+// stevedore's own keys, an OCI key in a LABEL stevedore marked, or because it is about to be written
+func isOwnedKey(key string, desired []labelPair, marked bool) bool {
+	if ownedKeyPattern.MatchString(key) || (marked && ociKeyPattern.MatchString(key)) {
+		return true
+	}
+
+	for _, pair := range desired {
+		if pair.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isVolatileKey reports whether the value of an owned key is expected to change between runs
+func isVolatileKey(key string) bool {
+	return volatileKeyPattern.MatchString(key)
+}
+
+// isHeadKey reports whether an owned key records the commit the labels were written at
+func isHeadKey(key string) bool {
+	return headKeyPattern.MatchString(key)
+}
+
+// settledInstructions returns the text of every instruction with the comments before it, keeping
+// only the keys of the labels that record the labelling commit or change on every run, as their
+// values cannot stay the same once the labels are committed. It returns false when the content is
+// not a Dockerfile.
+func settledInstructions(content string) ([]string, bool) {
+	parsed, err := parser.Parse(strings.NewReader(content))
+	if err != nil || parsed.AST == nil {
+		return nil, false
+	}
+
+	var instructions []string
+
+	for _, node := range parsed.AST.Children {
+		instructions = append(instructions, node.PrevComment...)
+
+		if !isLabelNode(node) {
+			instructions = append(instructions, node.Original)
+			continue
+		}
+
+		parts := make([]string, 0, len(node.Children))
+
+		for _, pair := range labelPairs(node) {
+			if isHeadKey(pair.Key) || isVolatileKey(pair.Key) {
+				parts = append(parts, pair.Key)
+				continue
+			}
+
+			parts = append(parts, pair.raw)
+		}
+
+		instructions = append(instructions, "LABEL "+strings.Join(parts, " "))
+	}
+
+	return instructions, true
+}
+
+// isLabelNode reports whether an AST node is a LABEL instruction
+func isLabelNode(node *parser.Node) bool {
+	return strings.EqualFold(node.Value, "label")
+}
+
+// labelPairs extracts the key/value pairs from a LABEL node, keeping the original text of each pair
+func labelPairs(node *parser.Node) []labelPair {
+	var pairs []labelPair
+
+	// LABEL children are stored as key, value, separator triples
+	for key := node.Next; key != nil && key.Next != nil; {
+		value := key.Next
+		separator := "="
+		if value.Next != nil && value.Next.Value == "" {
+			separator = " "
+		}
+
+		pairs = append(pairs, labelPair{
+			Key:   unquote(key.Value),
+			Value: unquote(value.Value),
+			raw:   key.Value + separator + value.Value,
+		})
+
+		if value.Next == nil {
+			break
+		}
+
+		key = value.Next.Next
+	}
+
+	return pairs
+}
+
+// isMarked reports whether the pairs of a LABEL include stevedore's tool marker
+func isMarked(pairs []labelPair) bool {
+	for _, pair := range pairs {
+		if toolKeyPattern.MatchString(pair.Key) && pair.Value == "stevedore" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasOwnedKeys reports whether any of the pairs are managed by stevedore
+func hasOwnedKeys(pairs, desired []labelPair) bool {
+	marked := isMarked(pairs)
+
+	for _, pair := range pairs {
+		if isOwnedKey(pair.Key, desired, marked) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeLabels replaces owned keys in existing with the desired values, keeping user keys untouched.
+// Owned keys that are no longer desired, or that appear more than once, are dropped.
+func mergeLabels(existing, desired []labelPair) []labelPair {
+	wanted := make(map[string]labelPair, len(desired))
+	for _, pair := range desired {
+		wanted[pair.Key] = pair
+	}
+
+	seen := make(map[string]bool, len(desired))
+	merged := make([]labelPair, 0, len(existing)+len(desired))
+	marked := isMarked(existing)
+
+	for _, pair := range existing {
+		if !isOwnedKey(pair.Key, desired, marked) {
+			merged = append(merged, pair)
+			continue
+		}
+
+		replacement, ok := wanted[pair.Key]
+		if !ok || seen[pair.Key] {
+			continue
+		}
+
+		seen[pair.Key] = true
+		merged = append(merged, replacement)
+	}
+
+	for _, pair := range desired {
+		if !seen[pair.Key] {
+			merged = append(merged, pair)
+		}
+	}
+
+	return merged
+}
+
+// stripLabels removes the owned keys from existing, keeping user keys untouched
+func stripLabels(existing, desired []labelPair) []labelPair {
+	var stripped []labelPair
+
+	marked := isMarked(existing)
+
+	for _, pair := range existing {
+		if !isOwnedKey(pair.Key, desired, marked) {
+			stripped = append(stripped, pair)
+		}
+	}
+
+	return stripped
+}
+
+// keepVolatileValues reuses previous values for volatile keys when nothing else has changed,
+// so that relabeling an unchanged Dockerfile produces identical output
+func keepVolatileValues(previous map[string]string, desired []labelPair) []labelPair {
+	for _, pair := range desired {
+		if isVolatileKey(pair.Key) {
+			continue
+		}
+
+		if value, ok := previous[pair.Key]; !ok || value != pair.Value {
+			return desired
+		}
+	}
+
+	stable := make([]labelPair, len(desired))
+	for i, pair := range desired {
+		if value, ok := previous[pair.Key]; ok && isVolatileKey(pair.Key) {
+			pair.Value = value
+		}
+		stable[i] = pair
+	}
+
+	return stable
+}
+
+// rewriteLabel turns a LABEL instruction holding the existing pairs into one holding the merged
+// pairs, keeping its line layout. Pairs that change are replaced where they stand, dropped pairs
+// are removed along with any line they leave empty, and new pairs go at the end, on a continuation
+// line of their own when the instruction already spans several lines. It falls back to a single
+// line when the pairs cannot be found in the source.
+func rewriteLabel(source []byte, node *parser.Node, existing, merged []labelPair) string {
+	text := nodeText(source, node)
+
+	// the pairs are looked for after the instruction keyword
+	cursor := strings.IndexAny(text, " \t")
+	if cursor < 0 {
+		return renderLabel(merged)
+	}
+
+	var out strings.Builder
+
+	out.WriteString(text[:cursor])
+
+	next := 0
+
+	for _, pair := range existing {
+		offset := strings.Index(text[cursor:], pair.raw)
+		if pair.raw == "" || offset < 0 {
+			return renderLabel(merged)
+		}
+
+		out.WriteString(text[cursor : cursor+offset])
+		cursor += offset + len(pair.raw)
+
+		if next < len(merged) && merged[next].Key == pair.Key {
+			out.WriteString(merged[next].String())
+			next++
+
+			continue
+		}
+
+		// a dropped pair takes the space before it along
+		trimmed := strings.TrimRight(out.String(), " \t")
+		out.Reset()
+		out.WriteString(trimmed)
+	}
+
+	out.WriteString(text[cursor:])
+
+	lines := dropEmptyLines(strings.Split(text, "\n"), strings.Split(out.String(), "\n"))
+
+	if added := merged[next:]; len(added) > 0 {
+		parts := make([]string, 0, len(added))
+		for _, pair := range added {
+			parts = append(parts, pair.String())
+		}
+
+		last := len(lines) - 1
+		if last == 0 {
+			lines[last] += " " + strings.Join(parts, " ")
+		} else {
+			indent := lines[last][:len(lines[last])-len(strings.TrimLeft(lines[last], " \t"))]
+			lines[last] += " \\" + carriageReturn(lines[0])
+			lines = append(lines, indent+strings.Join(parts, " "))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// dropEmptyLines removes the continuation lines that lost all their pairs, and the line
+// continuation from the end of the instruction when its last line was removed
+func dropEmptyLines(original, updated []string) []string {
+	kept := make([]string, 0, len(updated))
+
+	for i, line := range updated {
+		if i > 0 && isBlankContinuation(line) && !isBlankContinuation(original[i]) {
+			continue
+		}
+
+		kept = append(kept, line)
+	}
+
+	last := len(kept) - 1
+	if trimmed := strings.TrimRight(kept[last], " \t\r"); strings.HasSuffix(trimmed, "\\") {
+		kept[last] = strings.TrimRight(strings.TrimSuffix(trimmed, "\\"), " \t")
+	}
+
+	return kept
+}
+
+// isBlankContinuation reports whether a line of a multi-line instruction holds nothing but a
+// line continuation
+func isBlankContinuation(line string) bool {
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), "\\")) == ""
+}
+
+// carriageReturn returns the \r ending a line of a file with Windows line endings
+func carriageReturn(line string) string {
+	if strings.HasSuffix(line, "\r") {
+		return "\r"
+	}
+
+	return ""
+}
+
+// renderLabel formats the pairs as a single LABEL instruction
+func renderLabel(pairs []labelPair) string {
+	parts := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		parts = append(parts, pair.String())
+	}
+
+	return "LABEL " + strings.Join(parts, " ")
+}
+
+// String formats the pair, preserving the original text when the pair was read from a Dockerfile
+func (p labelPair) String() string {
+	if p.raw != "" {
+		return p.raw
+	}
+
+	return p.Key + "=" + quote(p.Value)
+}
+
+// quote wraps a label value in double quotes, escaping characters the Dockerfile parser treats specially
+func quote(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`)
+
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// unquote strips the surrounding quotes and escapes from a label key or value
+func unquote(value string) string {
+	if len(value) >= 2 {
+		switch {
+		case value[0] == '"' && value[len(value)-1] == '"':
+			replacer := strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\$`, "$")
+			return replacer.Replace(value[1 : len(value)-1])
+		case value[0] == '\'' && value[len(value)-1] == '\'':
+			return value[1 : len(value)-1]
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,192 @@
+package dockerfile
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+func TestLabelPairs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		line string
+		want []labelPair
+	}{
+		{"key value", `LABEL a=b c="d e"`, []labelPair{{"a", "b", "a=b"}, {"c", "d e", `c="d e"`}}},
+		{"legacy", `LABEL a b c`, []labelPair{{"a", "b c", "a b c"}}},
+		{"quoted key", `LABEL "a.b"="c"`, []labelPair{{"a.b", "c", `"a.b"="c"`}}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			result, err := parser.Parse(strings.NewReader(tt.line))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			if got := labelPairs(result.AST.Children[0]); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("labelPairs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeLabels(t *testing.T) {
+	t.Parallel()
+
+	desired := []labelPair{
+		{Key: "layer.0.author", Value: "James Woolfenden"},
+		{Key: "layer.0.tool", Value: "stevedore"},
+	}
+
+	tests := []struct {
+		name     string
+		existing []labelPair
+		want     string
+	}{
+		{"new", nil, `LABEL layer.0.author="James Woolfenden" layer.0.tool="stevedore"`},
+		{
+			"replace in place",
+			[]labelPair{{"a", "b", "a=b"}, {"layer.0.author", "x", `layer.0.author="x"`}},
+			`LABEL a=b layer.0.author="James Woolfenden" layer.0.tool="stevedore"`,
+		},
+		{
+			"drop duplicates",
+			[]labelPair{{"layer.0.tool", "x", "layer.0.tool=x"}, {"layer.0.tool", "y", "layer.0.tool=y"}, {"git_repo", "z", "git_repo=z"}},
+			`LABEL layer.0.tool="stevedore" layer.0.author="James Woolfenden"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := renderLabel(mergeLabels(tt.existing, desired)); got != tt.want {
+				t.Errorf("mergeLabels() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteLabel(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		source  string
+		replace map[string]string
+		drop    []string
+		add     []labelPair
+		want    string
+	}{
+		{
+			"single line",
+			`LABEL a=b git_tag="v1" c=d`,
+			map[string]string{"git_tag": "v2"}, nil, []labelPair{{Key: "git_dirty", Value: "false"}},
+			`LABEL a=b git_tag="v2" c=d git_dirty="false"`,
+		},
+		{
+			"replaced in place",
+			"LABEL a=b \\\n  git_tag=\"v1\" \\\n  c=d",
+			map[string]string{"git_tag": "v2"}, nil, nil,
+			"LABEL a=b \\\n  git_tag=\"v2\" \\\n  c=d",
+		},
+		{
+			"added on a new line",
+			"LABEL a=b \\\n    c=d",
+			nil, nil, []labelPair{{Key: "git_tag", Value: "v1"}, {Key: "git_dirty", Value: "false"}},
+			"LABEL a=b \\\n    c=d \\\n    git_tag=\"v1\" git_dirty=\"false\"",
+		},
+		{
+			"middle line dropped",
+			"LABEL a=b \\\n  git_tag=\"v1\" \\\n  c=d",
+			nil, []string{"git_tag"}, nil,
+			"LABEL a=b \\\n  c=d",
+		},
+		{
+			"last line dropped",
+			"LABEL a=b \\\n  git_tag=\"v1\"",
+			nil, []string{"git_tag"}, nil,
+			"LABEL a=b",
+		},
+		{
+			"pair on a shared line dropped",
+			"LABEL a=b git_tag=\"v1\" \\\n  c=d",
+			nil, []string{"git_tag"}, nil,
+			"LABEL a=b \\\n  c=d",
+		},
+		{
+			"windows line endings",
+			"LABEL a=b \\\r\n  git_tag=\"v1\"",
+			map[string]string{"git_tag": "v2"}, nil, []labelPair{{Key: "git_dirty", Value: "false"}},
+			"LABEL a=b \\\r\n  git_tag=\"v2\" \\\r\n  git_dirty=\"false\"",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			result, err := parser.Parse(strings.NewReader(tt.source + "\n"))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			node := result.AST.Children[0]
+			existing := labelPairs(node)
+
+			var merged []labelPair
+
+			for _, pair := range existing {
+				switch value, ok := tt.replace[pair.Key]; {
+				case ok:
+					merged = append(merged, labelPair{Key: pair.Key, Value: value})
+				case !slices.Contains(tt.drop, pair.Key):
+					merged = append(merged, pair)
+				}
+			}
+
+			merged = append(merged, tt.add...)
+
+			if got := rewriteLabel([]byte(tt.source+"\n"), node, existing, merged); got != tt.want {
+				t.Errorf("rewriteLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeepVolatileValues(t *testing.T) {
+	t.Parallel()
+
+	desired := []labelPair{
+		{Key: "layer.0.author", Value: "James Woolfenden"},
+		{Key: "layer.0.trace", Value: "new"},
+	}
+
+	tests := []struct {
+		name     string
+		previous map[string]string
+		want     string
+	}{
+		{"unchanged", map[string]string{"layer.0.author": "James Woolfenden", "layer.0.trace": "old"}, "old"},
+		{"changed", map[string]string{"layer.0.author": "someone else", "layer.0.trace": "old"}, "new"},
+		{"first run", map[string]string{}, "new"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := keepVolatileValues(tt.previous, desired)[1].Value; got != tt.want {
+				t.Errorf("keepVolatileValues() trace = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
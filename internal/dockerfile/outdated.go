@@ -0,0 +1,123 @@
+package dockerfile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jameswoolfenden/stevedore/internal/registry"
+)
+
+// Pin is a FROM instruction that references its base image by both tag and digest
+type Pin struct {
+	Path    string `json:"path"`
+	Stage   string `json:"stage"`
+	Image   string `json:"image"`
+	Pinned  string `json:"pinned"`
+	Current string `json:"current,omitempty"`
+	Error   string `json:"error,omitempty"`
+
+	stage *Stage
+}
+
+// IsOutdated reports whether the tag now resolves to a different digest than the one pinned
+func (p Pin) IsOutdated() bool {
+	return p.Current != "" && p.Current != p.Pinned
+}
+
+// Outdated resolves the tag of each pinned FROM in the selected stages against its registry,
+// reporting the digest it points at now. Images pinned by digest alone have no tag to follow
+// and are skipped.
+func (l *Labeller) Outdated(dockerfile *Dockerfile) ([]Pin, error) {
+	if dockerfile.Parsed == nil {
+		return nil, fmt.Errorf("dockerfile is nil")
+	}
+
+	stages := dockerfile.Stages()
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("no FROM instruction found in %s", dockerfile.Path)
+	}
+
+	var pins []Pin
+
+	for _, stage := range l.chooseStages(stages) {
+		image, _, ok := strings.Cut(stage.BaseImage, "@")
+		if !ok || strings.Contains(stage.Image, "$") {
+			continue
+		}
+
+		ref, err := registry.ParseReference(stage.BaseImage)
+		if err != nil || ref.Tag == "" {
+			continue
+		}
+
+		pin := Pin{Path: dockerfile.Path, Stage: stage.ID(), Image: image, Pinned: ref.Digest, stage: stage}
+		ref.Digest = ""
+
+		details, err := l.registry.GetImage(ref)
+		if err != nil {
+			pin.Error = err.Error()
+		} else {
+			pin.Current = l.imageDigest(details)
+		}
+
+		pins = append(pins, pin)
+	}
+
+	return pins, nil
+}
+
+// UpdatePins rewrites the digest of each outdated pin, along with any label in the same stage that
+// recorded the old digest
+func (l *Labeller) UpdatePins(dockerfile *Dockerfile, pins []Pin) (string, error) {
+	source, err := dockerfile.source()
+	if err != nil {
+		return "", err
+	}
+
+	var edits []edit
+
+	for _, pin := range pins {
+		if !pin.IsOutdated() || pin.stage == nil {
+			continue
+		}
+
+		text, ok := replaceImage(nodeText(source, pin.stage.From), pin.Image+"@"+pin.Pinned, pin.Image+"@"+pin.Current)
+		if !ok {
+			return "", fmt.Errorf("cannot find %s in the FROM of stage %s", pin.Image, pin.Stage)
+		}
+
+		edits = append(edits, edit{node: pin.stage.From, text: text})
+		edits = append(edits, replaceDigestLabels(source, pin.stage, pin.Pinned, pin.Current)...)
+	}
+
+	return applyEdits(source, edits), nil
+}
+
+// replaceDigestLabels updates the LABELs of a stage that hold the old digest as a value
+func replaceDigestLabels(source []byte, stage *Stage, oldDigest, newDigest string) []edit {
+	var edits []edit
+
+	for _, child := range stage.Nodes {
+		if !isLabelNode(child) {
+			continue
+		}
+
+		existing := labelPairs(child)
+		pairs := make([]labelPair, len(existing))
+		changed := false
+
+		for i, pair := range existing {
+			pairs[i] = pair
+			if pair.Value == oldDigest {
+				pairs[i] = labelPair{Key: pair.Key, Value: newDigest}
+				changed = true
+			}
+		}
+
+		if changed {
+			edits = append(edits, edit{node: child, text: rewriteLabel(source, child, existing, pairs)})
+		}
+	}
+
+	return edits
+}
@@ -0,0 +1,60 @@
+package dockerfile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jameswoolfenden/stevedore/internal/auth"
+	"github.com/jameswoolfenden/stevedore/internal/registry"
+)
+
+func TestLabeller_Outdated(t *testing.T) {
+	t.Parallel()
+
+	server, digest := newTestRegistry(t, `{"config":{"Labels":{}}}`)
+	host := strings.TrimPrefix(server.URL, "https://")
+	old := "sha256:" + strings.Repeat("0", 64)
+
+	source := "FROM " + host + "/org/base:1.0@" + old + " AS build\n" +
+		"LABEL layer.0.parent.digest=\"" + old + "\" other=\"kept\"\n" +
+		"FROM " + host + "/org/base:1.0@" + digest + " AS current\n" +
+		"FROM alpine@" + old + "\n" +
+		"FROM alpine:3.19\n"
+
+	labeller := NewLabeler(nil, nil)
+	labeller.registry = registry.NewClient(auth.NewDockerAuthWithClient(server.Client()), server.Client())
+
+	dockerfile := parseSource(t, source)
+
+	pins, err := labeller.Outdated(dockerfile)
+	if err != nil {
+		t.Fatalf("Outdated() error = %v", err)
+	}
+
+	if len(pins) != 2 {
+		t.Fatalf("Outdated() = %+v, want the two tagged pins", pins)
+	}
+
+	if !pins[0].IsOutdated() || pins[0].Current != digest || pins[0].Stage != "build" {
+		t.Errorf("Outdated() build = %+v, want it to have moved to %s", pins[0], digest)
+	}
+
+	if pins[1].IsOutdated() {
+		t.Errorf("Outdated() current = %+v, want it up to date", pins[1])
+	}
+
+	got, err := labeller.UpdatePins(dockerfile, pins)
+	if err != nil {
+		t.Fatalf("UpdatePins() error = %v", err)
+	}
+
+	want := "FROM " + host + "/org/base:1.0@" + digest + " AS build\n" +
+		"LABEL layer.0.parent.digest=\"" + digest + "\" other=\"kept\"\n" +
+		"FROM " + host + "/org/base:1.0@" + digest + " AS current\n" +
+		"FROM alpine@" + old + "\n" +
+		"FROM alpine:3.19\n"
+
+	if got != want {
+		t.Errorf("UpdatePins() = %q, want %q", got, want)
+	}
+}
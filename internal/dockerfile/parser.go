@@ -1,22 +1,51 @@
 package dockerfile
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"strings"
+	"slices"
+	"sync"
+	"sync/atomic"
 
 	"github.com/jameswoolfenden/stevedore/internal/config"
+	"github.com/jameswoolfenden/stevedore/internal/fsutil"
 	"github.com/rs/zerolog/log"
 )
 
+// ErrChangesPending is returned in dry-run mode when at least one Dockerfile would be changed
+var ErrChangesPending = errors.New("dockerfiles would be changed")
+
 // Parser coordinates the scanning and processing of Dockerfiles
 type Parser struct {
 	File      string
 	Output    string
 	Directory string
 	Author    string
-	labeller  *Labeller
+	DryRun    bool
+	Out       io.Writer
+	// InPlace writes each Dockerfile back to where it was read from, instead of under Output
+	InPlace bool
+	// Jobs is how many Dockerfiles are processed at once
+	Jobs int
+	// FailFast stops starting new files after the first failure, instead of reporting every failure at the end
+	FailFast bool
+	// Include are the name patterns of the files taken to be Dockerfiles, replacing the defaults when set
+	Include []string
+	// Exclude are name patterns of files and directories to skip, on top of the defaults
+	Exclude []string
+	// MaxDepth limits how many directories deep the scan goes, with 0 for no limit
+	MaxDepth int
+	// NoIgnore scans the paths .gitignore and .dockerignore files would have skipped
+	NoIgnore bool
+	labeller *Labeller
+	mu       sync.Mutex
+	changed  bool
+	// diffs holds the dry-run diff of each changed file, written in file order once all are done
+	diffs   map[string]string
+	reports []FileReport
 }
 
 // NewParser creates a new Parser instance
@@ -24,82 +53,441 @@ func NewParser(labeller *Labeller) *Parser {
 	return &Parser{
 		labeller: labeller,
 		Output:   ".",
+		Out:      os.Stdout,
+		Jobs:     1,
 	}
 }
 
 // ParseAll processes either a single file or all Dockerfiles in a directory
 func (p *Parser) ParseAll() error {
+	files, err := p.files()
+	if err != nil {
+		return err
+	}
+
+	reports := make([]FileReport, len(files))
+
+	err = p.run(files, func(i int, filePath string) error {
+		report, err := p.parseFile(filePath)
+		reports[i] = fileReport(report, filePath, err)
+
+		return err
+	})
+
+	p.reports = startedReports(reports)
+
+	if err == nil && p.DryRun && p.changed {
+		return ErrChangesPending
+	}
+
+	return err
+}
+
+// Reports returns what the last ParseAll or CheckAll did with each file it got to
+func (p *Parser) Reports() []FileReport {
+	return p.reports
+}
+
+// fileReport completes the report of a file with its path and any failure
+func fileReport(report FileReport, filePath string, err error) FileReport {
+	report.Path = filePath
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	return report
+}
+
+// startedReports drops the reports of files never started after a failure in fail-fast mode
+func startedReports(reports []FileReport) []FileReport {
+	started := make([]FileReport, 0, len(reports))
+
+	for _, report := range reports {
+		if report.Path != "" {
+			started = append(started, report)
+		}
+	}
+
+	return started
+}
+
+// CheckAll verifies the labels of either a single file or all Dockerfiles in a directory
+func (p *Parser) CheckAll(required []string) ([]Finding, error) {
+	files, err := p.files()
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]FileReport, len(files))
+
+	err = p.run(files, func(i int, filePath string) error {
+		found, err := p.checkFile(filePath, required)
+		reports[i] = fileReport(FileReport{Findings: found}, filePath, err)
+
+		return err
+	})
+
+	p.reports = startedReports(reports)
+
+	var findings []Finding
+	for _, report := range p.reports {
+		findings = append(findings, report.Findings...)
+	}
+
+	return findings, err
+}
+
+// checkFile checks the labels of a single Dockerfile
+func (p *Parser) checkFile(filePath string, required []string) ([]Finding, error) {
+	dockerfile := &Dockerfile{
+		Path: filePath,
+	}
+
+	if err := dockerfile.ParseFile(); err != nil {
+		return nil, fmt.Errorf("failed to parse dockerfile: %w", err)
+	}
+
+	found, err := p.labeller.Check(dockerfile, p.Author, required)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check labels: %w", err)
+	}
+
+	return found, nil
+}
+
+// OutdatedAll reports the pinned base images of either a single file or all Dockerfiles in a
+// directory, rewriting the files in place whose pins have moved when update is set
+func (p *Parser) OutdatedAll(update bool) ([]Pin, error) {
+	files, err := p.files()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]Pin, len(files))
+
+	err = p.run(files, func(i int, filePath string) error {
+		dockerfile := &Dockerfile{
+			Path: filePath,
+		}
+
+		if err := dockerfile.ParseFile(); err != nil {
+			return fmt.Errorf("failed to parse dockerfile: %w", err)
+		}
+
+		found, err := p.labeller.Outdated(dockerfile)
+		if err != nil {
+			return fmt.Errorf("failed to resolve base images: %w", err)
+		}
+
+		results[i] = found
+
+		if !update {
+			return nil
+		}
+
+		dump, err := p.labeller.UpdatePins(dockerfile, found)
+		if err != nil {
+			return fmt.Errorf("failed to update pins: %w", err)
+		}
+
+		if dump == string(dockerfile.Source) {
+			return nil
+		}
+
+		return p.writeFile(filePath, filePath, string(dockerfile.Source), dump)
+	})
+
+	var pins []Pin
+	for _, found := range results {
+		pins = append(pins, found...)
+	}
+
+	if err == nil && p.DryRun && p.changed {
+		return pins, ErrChangesPending
+	}
+
+	return pins, err
+}
+
+// InspectAll lists the labels declared in either a single file or all Dockerfiles in a directory
+func (p *Parser) InspectAll(buildArgs map[string]string, parents bool) ([]InspectedStage, error) {
+	files, err := p.files()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]InspectedStage, len(files))
+
+	err = p.run(files, func(i int, filePath string) error {
+		dockerfile := &Dockerfile{
+			Path: filePath,
+		}
+
+		if err := dockerfile.ParseFile(); err != nil {
+			return fmt.Errorf("failed to parse dockerfile: %w", err)
+		}
+
+		found, err := p.labeller.Inspect(dockerfile, buildArgs, parents)
+		if err != nil {
+			return fmt.Errorf("failed to inspect labels: %w", err)
+		}
+
+		results[i] = found
+
+		return nil
+	})
+
+	var stages []InspectedStage
+	for _, found := range results {
+		stages = append(stages, found...)
+	}
+
+	return stages, err
+}
+
+// files lists the single file, or every Dockerfile in the directory
+func (p *Parser) files() ([]string, error) {
+	var files []string
+	var err error
+
 	if p.File != "" {
-		return p.parseSingleFile()
+		files, err = p.singleFile()
+	} else {
+		files, err = p.directoryFiles()
+	}
+
+	if err != nil {
+		return nil, err
 	}
 
-	return p.parseDirectory()
+	p.labeller.scanned(files)
+
+	return files, nil
 }
 
-// parseSingleFile processes a single Dockerfile
-func (p *Parser) parseSingleFile() error {
+// singleFile validates the single Dockerfile to process
+func (p *Parser) singleFile() ([]string, error) {
 	if err := config.ValidateDockerfilePath(p.File); err != nil {
-		return fmt.Errorf("invalid file path: %w", err)
+		return nil, fmt.Errorf("invalid file path: %w", err)
 	}
 
-	return p.parseFile(p.File)
+	return []string{p.File}, nil
 }
 
-// parseDirectory walks a directory tree and processes all Dockerfiles
-func (p *Parser) parseDirectory() error {
+// directoryFiles walks a directory tree and lists the Dockerfiles that match the include patterns
+// and are neither excluded nor ignored
+func (p *Parser) directoryFiles() ([]string, error) {
 	if p.Directory == "" {
 		p.Directory = "."
 	}
 
 	if err := config.ValidateDockerfilePath(p.Directory); err != nil {
-		return fmt.Errorf("invalid directory path: %w", err)
+		return nil, fmt.Errorf("invalid directory path: %w", err)
 	}
 
-	err := filepath.Walk(p.Directory, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	walker, err := newWalker(p)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := walker.walk()
+	if err != nil {
+		return nil, fmt.Errorf("directory walk failed: %w", err)
+	}
+
+	return files, nil
+}
+
+// run calls fn for each file on a pool of workers. Every file is processed and all the failures
+// are returned together, unless FailFast is set, when no new file is started after the first
+// failure and only that failure is returned. A --stages id that matched no stage in any of the
+// files is an error.
+func (p *Parser) run(files []string, fn func(i int, filePath string) error) error {
+	workers := min(max(p.Jobs, 1), len(files))
+	errs := make([]error, len(files))
+	indexes := make(chan int)
+
+	var failed atomic.Bool
+	var wg sync.WaitGroup
 
-		if !info.IsDir() && strings.Contains(info.Name(), "Dockerfile") {
-			if parseErr := p.parseFile(path); parseErr != nil {
-				log.Error().Err(parseErr).Msgf("failed to parse %s", path)
-				return parseErr
+	for range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				// the file may have been handed over while an earlier one was failing
+				if p.FailFast && failed.Load() {
+					continue
+				}
+
+				if err := fn(i, files[i]); err != nil {
+					log.Error().Err(err).Msgf("failed to parse %s", files[i])
+					errs[i] = fmt.Errorf("%s: %w", files[i], err)
+					failed.Store(true)
+				}
 			}
+		}()
+	}
+
+	for i := range files {
+		if p.FailFast && failed.Load() {
+			break
 		}
 
-		return nil
-	})
+		indexes <- i
+	}
 
-	if err != nil {
-		return fmt.Errorf("directory walk failed: %w", err)
+	close(indexes)
+	wg.Wait()
+
+	if err := p.writeDiffs(files); err != nil {
+		return err
 	}
 
-	return nil
+	if p.FailFast {
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	// a stage id may only be found in some of the files, so it is wrong when no file has it
+	return p.labeller.unmatchedStages()
 }
 
 // parseFile parses a single Dockerfile and writes the labeled version
-func (p *Parser) parseFile(filePath string) error {
+func (p *Parser) parseFile(filePath string) (FileReport, error) {
 	dockerfile := &Dockerfile{
 		Path: filePath,
 	}
 
 	if err := dockerfile.ParseFile(); err != nil {
-		return fmt.Errorf("failed to parse dockerfile: %w", err)
+		return FileReport{}, fmt.Errorf("failed to parse dockerfile: %w", err)
 	}
 
-	dump, err := p.labeller.Label(dockerfile, p.Author)
+	dump, report, err := p.labeller.label(dockerfile, p.Author)
 	if err != nil {
-		return fmt.Errorf("failed to add labels: %w", err)
+		return report, fmt.Errorf("failed to add labels: %w", err)
 	}
 
-	outputPath := filepath.Join(p.Output, filepath.Base(filePath))
+	outputPath, err := p.outputPath(filePath)
+	if err != nil {
+		return report, err
+	}
 
-	//#nosec
-	if err := os.WriteFile(outputPath, []byte(dump), 0o644); err != nil {
+	if !p.DryRun {
+		report.Output = outputPath
+	}
+
+	return report, p.writeFile(filePath, outputPath, string(dockerfile.Source), dump)
+}
+
+// outputPath is where the labeled version of a Dockerfile is written: the file itself in place,
+// otherwise its path relative to the scanned directory under Output
+func (p *Parser) outputPath(filePath string) (string, error) {
+	if p.InPlace {
+		return filePath, nil
+	}
+
+	root := p.Directory
+	if p.File != "" {
+		root = filepath.Dir(p.File)
+	}
+
+	rel, err := filepath.Rel(root, filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to find %s under %s: %w", filePath, root, err)
+	}
+
+	return filepath.Join(p.Output, rel), nil
+}
+
+// writeFile writes the new content of a Dockerfile, or prints a diff of it in dry-run mode
+func (p *Parser) writeFile(filePath, outputPath, before, dump string) error {
+	if p.DryRun {
+		return p.printDiff(filePath, before, dump)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file mode of %s: %w", filePath, err)
+	}
+
+	if err := fsutil.WriteAtomic(outputPath, []byte(dump), info.Mode().Perm()); err != nil {
 		return fmt.Errorf("failed to write file %s: %w", outputPath, err)
 	}
 
-	log.Info().Msgf("updated: %s", filepath.Base(filePath))
+	log.Info().Msgf("updated: %s", outputPath)
+
+	return nil
+}
+
+// printDiff writes a unified diff of the proposed changes instead of updating the file
+func (p *Parser) printDiff(filePath, before, after string) error {
+	diff := unifiedDiff(filepath.ToSlash(filePath), before, after)
+	if diff == "" {
+		log.Info().Msgf("unchanged: %s", filePath)
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pendingChange(before, after) {
+		p.changed = true
+	}
+
+	if p.diffs == nil {
+		p.diffs = make(map[string]string)
+	}
+
+	p.diffs[filePath] = diff
+
+	return nil
+}
+
+// pendingChange reports whether a change is more than new values for the labels recording the
+// labelling commit, which always differ from HEAD once the labels are committed, so a dry run of
+// committed labels passes
+func pendingChange(before, after string) bool {
+	old, ok := settledInstructions(before)
+	if !ok {
+		return true
+	}
+
+	updated, ok := settledInstructions(after)
+	if !ok {
+		return true
+	}
+
+	return !slices.Equal(old, updated)
+}
+
+// writeDiffs writes the diffs held back while files were processed, in file order whatever order
+// the workers finished in
+func (p *Parser) writeDiffs(files []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, filePath := range files {
+		diff, ok := p.diffs[filePath]
+		if !ok {
+			continue
+		}
+
+		delete(p.diffs, filePath)
+
+		if _, err := io.WriteString(p.Out, diff); err != nil {
+			return fmt.Errorf("failed to write diff for %s: %w", filePath, err)
+		}
+	}
 
 	return nil
 }
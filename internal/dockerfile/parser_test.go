@@ -0,0 +1,307 @@
+package dockerfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTree creates files under a temporary directory, returning the directory
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestParser_CheckAll(t *testing.T) {
+	t.Parallel()
+
+	dir := writeTree(t, map[string]string{
+		"a/Dockerfile": "FROM alpine\n",
+		"b/Dockerfile": "RUN echo no base\n",
+		"c/Dockerfile": "FROM alpine\nLABEL layer.0.author=\"James Woolfenden\"\n",
+		"d/Dockerfile": "FROM alpine\n",
+		"e/Dockerfile": "RUN echo no base either\n",
+	})
+
+	tests := []struct {
+		name       string
+		jobs       int
+		failFast   bool
+		wantErrs   []string
+		wantNoErrs []string
+	}{
+		{"sequential", 1, false, []string{"b/Dockerfile", "e/Dockerfile"}, nil},
+		{"parallel", 4, false, []string{"b/Dockerfile", "e/Dockerfile"}, nil},
+		{"fail fast", 1, true, []string{"b/Dockerfile"}, []string{"e/Dockerfile"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			parser := NewParser(NewLabeler(nil, nil))
+			parser.Directory = dir
+			parser.Author = "James Woolfenden"
+			parser.Jobs = tt.jobs
+			parser.FailFast = tt.failFast
+
+			findings, err := parser.CheckAll([]string{"author"})
+			if err == nil {
+				t.Fatalf("CheckAll() error = nil, want the files without FROM reported")
+			}
+
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(filepath.ToSlash(err.Error()), want) {
+					t.Errorf("CheckAll() error = %v, want it to mention %s", err, want)
+				}
+			}
+
+			for _, unwanted := range tt.wantNoErrs {
+				if strings.Contains(filepath.ToSlash(err.Error()), unwanted) {
+					t.Errorf("CheckAll() error = %v, want it to stop before %s", err, unwanted)
+				}
+			}
+
+			if tt.failFast {
+				return
+			}
+
+			var paths []string
+			for _, finding := range findings {
+				paths = append(paths, filepath.ToSlash(strings.TrimPrefix(finding.Path, dir)))
+			}
+
+			if strings.Join(paths, ",") != "/a/Dockerfile,/d/Dockerfile" {
+				t.Errorf("CheckAll() findings for %v, want a and d in order", paths)
+			}
+		})
+	}
+}
+
+func TestParser_ParseAllOutput(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		inPlace bool
+	}{
+		{"mirrored", false},
+		{"in place", true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := writeTree(t, map[string]string{
+				"services/api/Dockerfile": "FROM scratch AS api\n",
+				"services/web/Dockerfile": "FROM scratch AS web\n",
+			})
+
+			web := filepath.Join(dir, "services", "web", "Dockerfile")
+			if err := os.Chmod(web, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			output := t.TempDir()
+
+			parser := NewParser(NewLabeler(nil, nil))
+			parser.Directory = filepath.Join(dir, "services")
+			parser.Output = output
+			parser.InPlace = tt.inPlace
+			parser.Author = "James Woolfenden"
+
+			if err := parser.ParseAll(); err != nil {
+				t.Fatalf("ParseAll() error = %v", err)
+			}
+
+			root := output
+			if tt.inPlace {
+				root = parser.Directory
+			}
+
+			for _, name := range []string{"api", "web"} {
+				path := filepath.Join(root, name, "Dockerfile")
+
+				content, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("ParseAll() did not write %s: %v", path, err)
+				}
+
+				if !strings.Contains(string(content), "AS "+name) || !strings.Contains(string(content), "LABEL") {
+					t.Errorf("ParseAll() wrote %s = %q, want the labelled %s Dockerfile", path, content, name)
+				}
+			}
+
+			info, err := os.Stat(filepath.Join(root, "web", "Dockerfile"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info.Mode().Perm() != 0o600 {
+				t.Errorf("ParseAll() wrote mode %v, want the original 0600", info.Mode().Perm())
+			}
+
+			if entries, _ := os.ReadDir(filepath.Join(root, "web")); len(entries) != 1 {
+				t.Errorf("ParseAll() left %d files in the output directory, want 1", len(entries))
+			}
+		})
+	}
+}
+
+func TestParser_runFailFast(t *testing.T) {
+	t.Parallel()
+
+	parser := NewParser(NewLabeler(nil, nil))
+	parser.FailFast = true
+
+	var processed []string
+
+	err := parser.run([]string{"bad", "good"}, func(i int, filePath string) error {
+		processed = append(processed, filePath)
+
+		if i == 0 {
+			// fail only once the next file is waiting to be handed over
+			time.Sleep(50 * time.Millisecond)
+			return errors.New("no FROM instruction found")
+		}
+
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("run() error = nil, want the bad file reported")
+	}
+
+	if strings.Join(processed, ",") != "bad" {
+		t.Errorf("run() processed %v, want it to stop after the bad file", processed)
+	}
+}
+
+func TestParser_runDiffOrder(t *testing.T) {
+	t.Parallel()
+
+	files := []string{"a/Dockerfile", "b/Dockerfile", "c/Dockerfile", "d/Dockerfile"}
+
+	var out strings.Builder
+
+	parser := NewParser(NewLabeler(nil, nil))
+	parser.DryRun = true
+	parser.Jobs = len(files)
+	parser.Out = &out
+
+	err := parser.run(files, func(i int, filePath string) error {
+		// the later files finish first
+		time.Sleep(time.Duration(len(files)-i) * 20 * time.Millisecond)
+		return parser.writeFile(filePath, filePath, "FROM scratch\n", "FROM scratch\nLABEL a=b\n")
+	})
+	if err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	last := -1
+	for _, file := range files {
+		index := strings.Index(out.String(), "+++ b/"+file)
+		if index <= last {
+			t.Fatalf("run() printed the diff of %s out of order:\n%s", file, out.String())
+		}
+
+		last = index
+	}
+}
+
+func TestPendingChange(t *testing.T) {
+	t.Parallel()
+
+	before := "FROM alpine\nLABEL a=b layer.0.trace=\"1\" git_commit=\"abc\" git_dirty=\"false\"\n"
+
+	tests := []struct {
+		name  string
+		after string
+		want  bool
+	}{
+		{"commit and trace only", "FROM alpine\nLABEL a=b layer.0.trace=\"2\" git_commit=\"def\" git_dirty=\"false\"\n", false},
+		{"owned label changed", "FROM alpine\nLABEL a=b layer.0.trace=\"2\" git_commit=\"def\" git_dirty=\"true\"\n", true},
+		{"commit label added", "FROM alpine\nLABEL a=b layer.0.trace=\"1\" git_commit=\"abc\" git_dirty=\"false\" git_commit_time=\"x\"\n", true},
+		{"instruction changed", "FROM alpine:3\nLABEL a=b layer.0.trace=\"1\" git_commit=\"abc\" git_dirty=\"false\"\n", true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := pendingChange(before, tt.after); got != tt.want {
+				t.Errorf("pendingChange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParser_ParseAllStages(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		stages  []string
+		wantErr string
+	}{
+		{"in one of the files", []string{"builder"}, ""},
+		{"in none of the files", []string{"builder", "biulder"}, "no stage biulder"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := writeTree(t, map[string]string{
+				"svc/api/Dockerfile": "FROM golang AS builder\nRUN make\nFROM scratch\n",
+				"web/Dockerfile":     "FROM nginx\n",
+			})
+
+			var out strings.Builder
+
+			labeller := NewLabeler(nil, nil)
+			labeller.Stages = tt.stages
+
+			parser := NewParser(labeller)
+			parser.Directory = dir
+			parser.Author = "James Woolfenden"
+			parser.DryRun = true
+			parser.Out = &out
+
+			err := parser.ParseAll()
+
+			if tt.wantErr == "" {
+				if !errors.Is(err, ErrChangesPending) {
+					t.Fatalf("ParseAll() error = %v, want ErrChangesPending", err)
+				}
+
+				if !strings.Contains(out.String(), `layer.0.stage="builder"`) || strings.Contains(out.String(), "web/Dockerfile") {
+					t.Errorf("ParseAll() diff = %s, want only the builder stage labelled", out.String())
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseAll() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
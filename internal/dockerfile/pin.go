@@ -0,0 +1,56 @@
+package dockerfile
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/rs/zerolog/log"
+)
+
+// pinStage rewrites the stage's FROM to reference its base image by digest, keeping the tag for
+// readability. FROM lines that already carry a digest or use build arguments are left alone.
+func pinStage(source []byte, stage *Stage, parent *parentImage) []edit {
+	if parent == nil || parent.Digest == "" || strings.Contains(stage.Image, "@") {
+		return nil
+	}
+
+	if strings.Contains(stage.Image, "$") {
+		log.Warn().Msgf("cannot pin %s in stage %s, it uses build arguments", stage.Image, stage.ID())
+		return nil
+	}
+
+	text, ok := replaceImage(nodeText(source, stage.From), stage.Image, stage.Image+"@"+parent.Digest)
+	if !ok {
+		log.Warn().Msgf("cannot find %s in the FROM of stage %s", stage.Image, stage.ID())
+		return nil
+	}
+
+	log.Info().Msgf("pinned: %s@%s", stage.Image, parent.Digest)
+
+	return []edit{{node: stage.From, text: text}}
+}
+
+// nodeText returns the source lines of an instruction, without the final line ending
+func nodeText(source []byte, node *parser.Node) string {
+	lines := strings.SplitAfter(string(source), "\n")
+	start, end := node.StartLine-1, node.EndLine
+	if start < 0 || end > len(lines) {
+		return node.Original
+	}
+
+	return strings.TrimRight(strings.Join(lines[start:end], ""), "\r\n")
+}
+
+// replaceImage swaps the image in a FROM instruction's text for a new reference
+func replaceImage(text, image, replacement string) (string, bool) {
+	pattern := regexp.MustCompile(`(\s)` + regexp.QuoteMeta(image) + `(\s|$)`)
+
+	loc := pattern.FindStringSubmatchIndex(text)
+	if loc == nil {
+		return text, false
+	}
+
+	// keep the surrounding whitespace captured by the pattern
+	return text[:loc[3]] + replacement + text[loc[4]:], true
+}
@@ -0,0 +1,79 @@
+package dockerfile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jameswoolfenden/stevedore/internal/auth"
+	"github.com/jameswoolfenden/stevedore/internal/registry"
+)
+
+func TestReplaceImage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		text   string
+		image  string
+		want   string
+		wantOK bool
+	}{
+		{"plain", "FROM alpine:3.19", "alpine:3.19", "FROM alpine:3.19@sha256:1", true},
+		{"named", "from node:18 as build", "node:18", "from node:18@sha256:1 as build", true},
+		{"flags", "FROM --platform=linux/amd64 node:18 AS build", "node:18", "FROM --platform=linux/amd64 node:18@sha256:1 AS build", true},
+		{"prefix of another word", "FROM node:18-alpine", "node:18", "FROM node:18-alpine", false},
+		{"continuation", "FROM \\\n  golang:1.22 AS build", "golang:1.22", "FROM \\\n  golang:1.22@sha256:1 AS build", true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := replaceImage(tt.text, tt.image, tt.image+"@sha256:1")
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("replaceImage() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLabeller_PinDigests(t *testing.T) {
+	t.Parallel()
+
+	server, digest := newTestRegistry(t, `{"config":{"Labels":{"layer.0.author":"Upstream"}}}`)
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	source := "FROM --platform=linux/amd64 " + host + "/org/base:1.0 AS build\nRUN make\n\nFROM scratch\nCOPY --from=build /app /app\n"
+
+	labeller := NewLabeler(nil, nil)
+	labeller.PinDigests = true
+	labeller.registry = registry.NewClient(auth.NewDockerAuthWithClient(server.Client()), server.Client())
+
+	got, err := labeller.Label(parseSource(t, source), "James Woolfenden")
+	if err != nil {
+		t.Fatalf("Label() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"FROM --platform=linux/amd64 " + host + "/org/base:1.0@" + digest + " AS build\n",
+		`layer.0.parent.digest="` + digest + `"`,
+		"FROM scratch\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Label() = %q, want it to contain %q", got, want)
+		}
+	}
+
+	if strings.Contains(got, "Upstream") {
+		t.Errorf("Label() = %q, copied upstream labels without --inherit", got)
+	}
+
+	again, err := labeller.Label(parseSource(t, got), "James Woolfenden")
+	if err != nil {
+		t.Fatalf("Label() second run error = %v", err)
+	}
+
+	if again != got {
+		t.Errorf("Label() is not idempotent, first %q, second %q", got, again)
+	}
+}
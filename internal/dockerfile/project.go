@@ -0,0 +1,171 @@
+package dockerfile
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jameswoolfenden/stevedore/internal/config"
+	"github.com/rs/zerolog/log"
+)
+
+// layerPrefixPattern matches the layer.N. prefix of per-layer keys
+var layerPrefixPattern = regexp.MustCompile(`^layer\.\d+\.`)
+
+// templateData is the data available to label templates in .stevedore.yaml
+type templateData struct {
+	Git   gitData
+	Build buildData
+	User  userData
+	Env   map[string]string
+	Stage string
+	Layer int64
+}
+
+// gitData is the git metadata available to label templates
+type gitData struct {
+	Repo   string
+	Org    string
+	File   string
+	Commit string
+	Source string
+	Branch string
+	Tag    string
+	Dirty  bool
+	// CommitTime is the HEAD commit time in RFC 3339
+	CommitTime string
+	LastCommit string
+}
+
+// buildData is the CI pipeline run available to label templates, empty outside CI
+type buildData struct {
+	Provider string
+	ID       string
+	URL      string
+}
+
+// userData is the author information available to label templates
+type userData struct {
+	Name  string
+	Email string
+}
+
+// applyProject filters the built-in labels, adds the project's static and template labels and
+// applies its key prefix
+func applyProject(project *config.Project, desired []labelPair, stage *Stage, meta metadata) []labelPair {
+	if project == nil {
+		return desired
+	}
+
+	var pairs []labelPair
+
+	for _, pair := range desired {
+		if wantKey(project.Keys, pair.Key) {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	for _, key := range sortedKeys(project.Labels) {
+		pairs = append(pairs, labelPair{Key: key, Value: project.Labels[key]})
+	}
+
+	data := newTemplateData(stage, meta)
+
+	for _, key := range sortedKeys(project.Templates) {
+		value, err := renderTemplate(key, project.Templates[key], data)
+		if err != nil {
+			log.Warn().Err(err).Msgf("failed to render template for %s", key)
+			continue
+		}
+
+		pairs = append(pairs, labelPair{Key: key, Value: value})
+	}
+
+	if project.Prefix != "" {
+		for i, pair := range pairs {
+			if !strings.HasPrefix(pair.Key, "org.opencontainers.image.") {
+				pairs[i].Key = project.Prefix + pair.Key
+			}
+		}
+	}
+
+	return pairs
+}
+
+// wantKey reports whether a built-in key is selected, matching either the full key or its name
+// without the layer prefix
+func wantKey(keys []string, key string) bool {
+	if len(keys) == 0 {
+		return true
+	}
+
+	name := layerPrefixPattern.ReplaceAllString(key, "")
+
+	for _, want := range keys {
+		if want == key || want == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newTemplateData collects the values label templates can reference
+func newTemplateData(stage *Stage, meta metadata) templateData {
+	env := make(map[string]string)
+
+	for _, entry := range os.Environ() {
+		if key, value, ok := strings.Cut(entry, "="); ok {
+			env[key] = value
+		}
+	}
+
+	return templateData{
+		Git: gitData{
+			Repo:       meta.Repo,
+			Org:        meta.Org,
+			File:       meta.File,
+			Commit:     meta.Commit,
+			Source:     meta.Source,
+			Branch:     meta.Branch,
+			Tag:        meta.Tag,
+			Dirty:      meta.Dirty,
+			CommitTime: meta.CommitTime,
+			LastCommit: meta.LastCommit,
+		},
+		Build: buildData{Provider: meta.BuildProvider, ID: meta.BuildID, URL: meta.BuildURL},
+		User:  userData{Name: meta.Author, Email: meta.Email},
+		Env:   env,
+		Stage: stage.ID(),
+		Layer: stage.Layer,
+	}
+}
+
+// renderTemplate executes a single template value
+func renderTemplate(name, text string, data templateData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+// sortedKeys returns the keys of a map in a stable order
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
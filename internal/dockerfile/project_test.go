@@ -0,0 +1,53 @@
+package dockerfile
+
+import (
+	"testing"
+
+	"github.com/jameswoolfenden/stevedore/internal/config"
+)
+
+func TestApplyProject(t *testing.T) {
+	t.Parallel()
+
+	desired := []labelPair{
+		{Key: "layer.0.author", Value: "James Woolfenden"},
+		{Key: "layer.0.trace", Value: "abc"},
+		{Key: "git_commit", Value: "123"},
+		{Key: ociRevision, Value: "123"},
+	}
+
+	stage := &Stage{Index: 0, Name: "builder"}
+	meta := metadata{Author: "James Woolfenden", Org: "acme"}
+
+	tests := []struct {
+		name    string
+		project *config.Project
+		want    string
+	}{
+		{"none", nil, `LABEL layer.0.author="James Woolfenden" layer.0.trace="abc" git_commit="123" org.opencontainers.image.revision="123"`},
+		{
+			"keys and prefix",
+			&config.Project{Prefix: "com.acme.", Keys: []string{"author", ociRevision}},
+			`LABEL com.acme.layer.0.author="James Woolfenden" org.opencontainers.image.revision="123"`,
+		},
+		{
+			"static and templates",
+			&config.Project{
+				Keys:      []string{"git_commit"},
+				Labels:    map[string]string{"team": "platform", "cost": "shared"},
+				Templates: map[string]string{"owner": "{{ .Git.Org }}/{{ .Stage }}", "missing": "{{ .Env.STEVEDORE_NOT_SET }}"},
+			},
+			`LABEL git_commit="123" cost="shared" team="platform" missing="" owner="acme/builder"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := renderLabel(applyProject(tt.project, desired, stage, meta)); got != tt.want {
+				t.Errorf("applyProject() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package dockerfile
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// FileReport records what a run did with a Dockerfile
+type FileReport struct {
+	Path string `json:"path"`
+	// Output is where the labeled Dockerfile was written, empty in dry-run mode
+	Output   string        `json:"output,omitempty"`
+	Changed  bool          `json:"changed"`
+	Stages   []StageReport `json:"stages,omitempty"`
+	Findings []Finding     `json:"findings,omitempty"`
+	Warnings []string      `json:"warnings,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// StageReport records the labels stevedore changed in a build stage and the base image it resolved
+type StageReport struct {
+	Stage string `json:"stage"`
+	// BaseImage is the image the stage is built from, with global ARGs expanded, empty when it
+	// is built from scratch or from an earlier stage
+	BaseImage  string `json:"baseImage,omitempty"`
+	BaseDigest string `json:"baseDigest,omitempty"`
+	// ParentStage is the id of the earlier stage the stage is built from
+	ParentStage string                 `json:"parentStage,omitempty"`
+	Added       map[string]string      `json:"added,omitempty"`
+	Changed     map[string]LabelChange `json:"changed,omitempty"`
+	Removed     map[string]string      `json:"removed,omitempty"`
+}
+
+// LabelChange is the old and new value of a label
+type LabelChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// warn records a warning once, however many stages raise it
+func (r *FileReport) warn(warnings ...string) {
+	for _, warning := range warnings {
+		if warning != "" && !slices.Contains(r.Warnings, warning) {
+			r.Warnings = append(r.Warnings, warning)
+		}
+	}
+}
+
+// stageReports compares the labels of each selected stage before and after labeling, reading
+// the result back through the parser so the report shows what a build would see
+func stageReports(stages []*Stage, parents map[int]*parentImage, dump string) ([]StageReport, error) {
+	parsed, err := parser.Parse(bytes.NewReader([]byte(dump)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse labeled dockerfile: %w", err)
+	}
+
+	after := (&Dockerfile{Parsed: parsed}).Stages()
+	reports := make([]StageReport, 0, len(stages))
+
+	for _, stage := range stages {
+		report := StageReport{Stage: stage.ID(), BaseImage: stage.BaseImage}
+		if stage.Parent != nil {
+			report.ParentStage = stage.Parent.ID()
+		}
+
+		if parent := parents[stage.Index]; parent != nil {
+			report.BaseImage = parent.Reference
+			report.BaseDigest = parent.Digest
+		}
+
+		if stage.Index < len(after) {
+			report.compare(stage.Labels(), after[stage.Index].Labels())
+		}
+
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// compare fills in the labels added, changed and removed between two sets of labels
+func (r *StageReport) compare(before, after map[string]string) {
+	for key, value := range after {
+		previous, ok := before[key]
+
+		switch {
+		case !ok:
+			if r.Added == nil {
+				r.Added = make(map[string]string)
+			}
+			r.Added[key] = value
+		case previous != value:
+			if r.Changed == nil {
+				r.Changed = make(map[string]LabelChange)
+			}
+			r.Changed[key] = LabelChange{From: previous, To: value}
+		}
+	}
+
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			if r.Removed == nil {
+				r.Removed = make(map[string]string)
+			}
+			r.Removed[key] = value
+		}
+	}
+}
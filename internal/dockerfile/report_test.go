@@ -0,0 +1,82 @@
+package dockerfile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLabeller_labelReport(t *testing.T) {
+	t.Parallel()
+
+	source := "FROM alpine\nLABEL team=a layer.0.author=\"someone\" layer.0.stage=\"old\"\n"
+
+	_, report, err := NewLabeler(nil, nil).label(parseSource(t, source), "James Woolfenden")
+	if err != nil {
+		t.Fatalf("label() error = %v", err)
+	}
+
+	if !report.Changed {
+		t.Errorf("label() Changed = false, want true")
+	}
+
+	if len(report.Stages) != 1 {
+		t.Fatalf("label() reported %d stages, want 1", len(report.Stages))
+	}
+
+	stage := report.Stages[0]
+
+	if stage.Stage != "0" || stage.BaseImage != "alpine" {
+		t.Errorf("label() stage = %q on %q, want 0 on alpine", stage.Stage, stage.BaseImage)
+	}
+
+	wantChanged := map[string]LabelChange{"layer.0.author": {From: "someone", To: "James Woolfenden"}}
+	if !reflect.DeepEqual(stage.Changed, wantChanged) {
+		t.Errorf("label() Changed = %v, want %v", stage.Changed, wantChanged)
+	}
+
+	wantRemoved := map[string]string{"layer.0.stage": "old"}
+	if !reflect.DeepEqual(stage.Removed, wantRemoved) {
+		t.Errorf("label() Removed = %v, want %v", stage.Removed, wantRemoved)
+	}
+
+	if stage.Added["layer.0.tool"] != "stevedore" || stage.Added["layer.0.trace"] == "" {
+		t.Errorf("label() Added = %v, want the tool and trace labels", stage.Added)
+	}
+
+	if _, ok := stage.Added["team"]; ok {
+		t.Errorf("label() Added = %v, want the untouched team label left out", stage.Added)
+	}
+
+	wantWarnings := []string{"git metadata unavailable: not in a git repository"}
+	if !reflect.DeepEqual(report.Warnings, wantWarnings) {
+		t.Errorf("label() Warnings = %v, want %v", report.Warnings, wantWarnings)
+	}
+}
+
+func TestLabeller_labelReportBaseImage(t *testing.T) {
+	t.Parallel()
+
+	source := "ARG BASE=golang:1.22\nFROM ${BASE} AS build\nFROM build AS test\nFROM scratch\n"
+
+	_, report, err := NewLabeler(nil, nil).label(parseSource(t, source), "James Woolfenden")
+	if err != nil {
+		t.Fatalf("label() error = %v", err)
+	}
+
+	want := []struct{ baseImage, parentStage string }{
+		{"golang:1.22", ""},
+		{"", "build"},
+		{"", ""},
+	}
+
+	if len(report.Stages) != len(want) {
+		t.Fatalf("label() reported %d stages, want %d", len(report.Stages), len(want))
+	}
+
+	for i, stage := range report.Stages {
+		if stage.BaseImage != want[i].baseImage || stage.ParentStage != want[i].parentStage {
+			t.Errorf("label() stage %s on %q from stage %q, want %q from stage %q",
+				stage.Stage, stage.BaseImage, stage.ParentStage, want[i].baseImage, want[i].parentStage)
+		}
+	}
+}
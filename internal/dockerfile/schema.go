@@ -0,0 +1,70 @@
+package dockerfile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Schema selects which set of label keys stevedore writes
+type Schema string
+
+const (
+	// SchemaLegacy writes stevedore's own layer.N.* and git_* keys
+	SchemaLegacy Schema = "legacy"
+	// SchemaOCI writes the OCI pre-defined annotation keys
+	SchemaOCI Schema = "oci"
+	// SchemaBoth writes both sets of keys
+	SchemaBoth Schema = "both"
+)
+
+// OCI pre-defined annotation keys, see https://github.com/opencontainers/image-spec/blob/main/annotations.md
+const (
+	ociSource     = "org.opencontainers.image.source"
+	ociRevision   = "org.opencontainers.image.revision"
+	ociVersion    = "org.opencontainers.image.version"
+	ociAuthors    = "org.opencontainers.image.authors"
+	ociCreated    = "org.opencontainers.image.created"
+	ociTitle      = "org.opencontainers.image.title"
+	ociVendor     = "org.opencontainers.image.vendor"
+	ociLicenses   = "org.opencontainers.image.licenses"
+	ociBaseName   = "org.opencontainers.image.base.name"
+	ociBaseDigest = "org.opencontainers.image.base.digest"
+)
+
+// ParseSchema converts a schema name into a Schema
+func ParseSchema(name string) (Schema, error) {
+	switch schema := Schema(strings.ToLower(strings.TrimSpace(name))); schema {
+	case SchemaLegacy, SchemaOCI, SchemaBoth:
+		return schema, nil
+	case "":
+		return SchemaLegacy, nil
+	default:
+		return "", fmt.Errorf("unknown label schema %q, expected legacy, oci or both", name)
+	}
+}
+
+// ociLabels maps the metadata onto the OCI annotation keys, leaving out any without a value
+func ociLabels(meta metadata, licenses string) []labelPair {
+	candidates := []labelPair{
+		{Key: ociSource, Value: meta.Source},
+		{Key: ociRevision, Value: meta.Commit},
+		{Key: ociVersion, Value: meta.Tag},
+		{Key: ociAuthors, Value: meta.Author},
+		{Key: ociCreated, Value: meta.Created},
+		{Key: ociTitle, Value: meta.Repo},
+		{Key: ociVendor, Value: meta.Org},
+		{Key: ociLicenses, Value: licenses},
+		{Key: ociBaseName, Value: meta.BaseName},
+		{Key: ociBaseDigest, Value: meta.BaseDigest},
+	}
+
+	var pairs []labelPair
+
+	for _, pair := range candidates {
+		if pair.Value != "" {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	return pairs
+}
@@ -0,0 +1,137 @@
+package dockerfile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSchema(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		want    Schema
+		wantErr bool
+	}{
+		{"", SchemaLegacy, false},
+		{"legacy", SchemaLegacy, false},
+		{"OCI", SchemaOCI, false},
+		{"both", SchemaBoth, false},
+		{"guff", "", true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseSchema(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSchema() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseSchema() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOciLabels(t *testing.T) {
+	t.Parallel()
+
+	meta := metadata{Author: "James Woolfenden", Created: "2024-01-01T00:00:00Z", Commit: "abc"}
+	want := []labelPair{
+		{Key: ociRevision, Value: "abc"},
+		{Key: ociAuthors, Value: "James Woolfenden"},
+		{Key: ociCreated, Value: "2024-01-01T00:00:00Z"},
+	}
+
+	if got := ociLabels(meta, ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("ociLabels() = %v, want %v", got, want)
+	}
+}
+
+func TestLabeller_LabelSchemaSwitch(t *testing.T) {
+	t.Parallel()
+
+	source := "FROM alpine\nLABEL org.opencontainers.image.description=\"an app\"\n"
+
+	labeller := NewLabeler(nil, nil)
+	labeller.Schema = SchemaBoth
+
+	both, err := labeller.Label(parseSource(t, source), "James Woolfenden")
+	if err != nil {
+		t.Fatalf("Label() error = %v", err)
+	}
+
+	if !strings.Contains(both, ociAuthors) {
+		t.Fatalf("Label() = %q, want the OCI labels", both)
+	}
+
+	labeller.Schema = SchemaLegacy
+
+	legacy, err := labeller.Label(parseSource(t, both), "James Woolfenden")
+	if err != nil {
+		t.Fatalf("Label() error = %v", err)
+	}
+
+	if strings.Contains(legacy, ociAuthors) || strings.Contains(legacy, ociCreated) {
+		t.Errorf("Label() = %q, want the OCI labels stevedore wrote replaced", legacy)
+	}
+
+	if !strings.Contains(legacy, `org.opencontainers.image.description="an app"`) {
+		t.Errorf("Label() = %q, want the user's OCI label kept", legacy)
+	}
+
+	again, err := labeller.Label(parseSource(t, legacy), "James Woolfenden")
+	if err != nil {
+		t.Fatalf("Label() second run error = %v", err)
+	}
+
+	if again != legacy {
+		t.Errorf("Label() is not idempotent, first %q, second %q", legacy, again)
+	}
+}
+
+func TestLabeller_LabelKeepsUserOCILabels(t *testing.T) {
+	t.Parallel()
+
+	source := "FROM alpine\nLABEL org.opencontainers.image.licenses=\"MIT\" org.opencontainers.image.version=\"1.2.3\" " +
+		"org.opencontainers.image.source=\"https://example.com/app\" maintainer=\"me\"\n"
+
+	for _, schema := range []Schema{SchemaLegacy, SchemaOCI, SchemaBoth} {
+		schema := schema
+		t.Run(string(schema), func(t *testing.T) {
+			t.Parallel()
+			labeller := NewLabeler(nil, nil)
+			labeller.Schema = schema
+
+			got, err := labeller.Label(parseSource(t, source), "James Woolfenden")
+			if err != nil {
+				t.Fatalf("Label() error = %v", err)
+			}
+
+			for _, want := range []string{
+				`org.opencontainers.image.licenses="MIT"`,
+				`org.opencontainers.image.version="1.2.3"`,
+				`org.opencontainers.image.source="https://example.com/app"`,
+				`maintainer="me"`,
+			} {
+				if !strings.Contains(got, want) {
+					t.Errorf("Label() = %q, want the user's %s kept", got, want)
+				}
+			}
+
+			again, err := labeller.Label(parseSource(t, got), "James Woolfenden")
+			if err != nil {
+				t.Fatalf("Label() second run error = %v", err)
+			}
+
+			if again != got {
+				t.Errorf("Label() is not idempotent, first %q, second %q", got, again)
+			}
+		})
+	}
+}
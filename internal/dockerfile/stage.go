@@ -0,0 +1,202 @@
+package dockerfile
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// Stage is a build stage, starting at a FROM instruction and ending before the next one
+type Stage struct {
+	Index int
+	Name  string
+	Image string
+	// BaseImage is the external image the stage builds on with build arguments expanded, empty for
+	// scratch and for stages built from an earlier stage
+	BaseImage string
+	// Parent is the earlier stage this one builds on, if any
+	Parent *Stage
+	Layer  int64
+	From   *parser.Node
+	Nodes  []*parser.Node
+}
+
+// ID returns the stage name, or its index for unnamed stages
+func (s *Stage) ID() string {
+	if s.Name != "" {
+		return s.Name
+	}
+
+	return strconv.Itoa(s.Index)
+}
+
+// Last returns the final instruction in the stage
+func (s *Stage) Last() *parser.Node {
+	return s.Nodes[len(s.Nodes)-1]
+}
+
+// Labels returns the labels declared in the stage, later declarations overriding earlier ones
+func (s *Stage) Labels() map[string]string {
+	labels := make(map[string]string)
+
+	for _, child := range s.Nodes {
+		if !isLabelNode(child) {
+			continue
+		}
+
+		for _, pair := range labelPairs(child) {
+			labels[pair.Key] = pair.Value
+		}
+	}
+
+	return labels
+}
+
+// Stages splits the parsed Dockerfile into its build stages
+func (d *Dockerfile) Stages() []*Stage {
+	if d.Parsed == nil {
+		return nil
+	}
+
+	var stages []*Stage
+	var current *Stage
+
+	args := d.globalArgs()
+
+	for _, child := range d.Parsed.AST.Children {
+		if strings.EqualFold(child.Value, "from") {
+			current = newStage(child, stages, args)
+			stages = append(stages, current)
+		}
+
+		// instructions before the first FROM, such as global ARGs, belong to no stage
+		if current != nil {
+			current.Nodes = append(current.Nodes, child)
+		}
+	}
+
+	return stages
+}
+
+// BaseImage returns the external image the final stage is ultimately built on
+func (d *Dockerfile) BaseImage() string {
+	stages := d.Stages()
+	if len(stages) == 0 {
+		return ""
+	}
+
+	stage := stages[len(stages)-1]
+	for stage.Parent != nil {
+		stage = stage.Parent
+	}
+
+	return stage.BaseImage
+}
+
+// newStage creates a stage from a FROM instruction, deriving its layer from any earlier stage it builds on
+func newStage(from *parser.Node, previous []*Stage, args argEnv) *Stage {
+	stage := &Stage{
+		Index: len(previous),
+		From:  from,
+	}
+
+	if from.Next != nil {
+		stage.Image = from.Next.Value
+
+		if as := from.Next.Next; as != nil && strings.EqualFold(as.Value, "as") && as.Next != nil {
+			stage.Name = strings.ToLower(as.Next.Value)
+		}
+	}
+
+	image := expand(stage.Image, args)
+
+	if parent := findStage(previous, image); parent != nil {
+		stage.Parent = parent
+		stage.Layer = parent.Layer + 1
+	} else if !strings.EqualFold(image, "scratch") {
+		stage.BaseImage = image
+	}
+
+	return stage
+}
+
+// findStage looks up an earlier stage by name or index
+func findStage(stages []*Stage, id string) *Stage {
+	id = strings.ToLower(id)
+
+	for _, stage := range stages {
+		if stage.ID() == id {
+			return stage
+		}
+	}
+
+	return nil
+}
+
+// selectStages filters stages by the ids given, where "all" keeps every stage and "final" the last one,
+// also returning the ids that matched a stage
+func selectStages(stages []*Stage, ids []string) ([]*Stage, []string) {
+	if len(ids) == 0 || len(stages) == 0 {
+		return stages, nil
+	}
+
+	var (
+		selected []*Stage
+		matched  []string
+	)
+
+	for _, stage := range stages {
+		keep := false
+
+		for _, id := range ids {
+			id = strings.ToLower(strings.TrimSpace(id))
+
+			if id == "all" || stage.ID() == id || strconv.Itoa(stage.Index) == id ||
+				(id == "final" && stage.Index == len(stages)-1) {
+				matched = append(matched, id)
+				keep = true
+			}
+		}
+
+		if keep {
+			selected = append(selected, stage)
+		}
+	}
+
+	return selected, matched
+}
+
+// chooseStages selects the stages of a Dockerfile to work on, noting which --stages ids matched so
+// the run can report those that matched no stage in any file
+func (l *Labeller) chooseStages(stages []*Stage) []*Stage {
+	selected, matched := selectStages(stages, l.Stages)
+
+	l.stagesMu.Lock()
+	defer l.stagesMu.Unlock()
+
+	if l.matchedStages == nil {
+		l.matchedStages = make(map[string]bool)
+	}
+
+	for _, id := range matched {
+		l.matchedStages[id] = true
+	}
+
+	return selected
+}
+
+// unmatchedStages fails when a --stages id matched no stage in any of the Dockerfiles processed
+func (l *Labeller) unmatchedStages() error {
+	l.stagesMu.Lock()
+	defer l.stagesMu.Unlock()
+
+	for _, id := range l.Stages {
+		if id = strings.ToLower(strings.TrimSpace(id)); !l.matchedStages[id] {
+			return fmt.Errorf("no stage %s found in any Dockerfile", id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package dockerfile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+func TestDockerfile_Stages(t *testing.T) {
+	t.Parallel()
+
+	source := `ARG VERSION=18
+FROM golang AS Builder
+RUN make
+FROM builder AS test
+RUN make test
+FROM alpine
+COPY --from=builder /app /app`
+
+	parsed, err := parser.Parse(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	dockerfile := &Dockerfile{Parsed: parsed}
+	stages := dockerfile.Stages()
+
+	tests := []struct {
+		name        string
+		ids         []string
+		want        []string
+		wantMatched []string
+	}{
+		{"all", []string{"all"}, []string{"builder", "test", "2"}, []string{"all", "all", "all"}},
+		{"default", nil, []string{"builder", "test", "2"}, nil},
+		{"final", []string{"final"}, []string{"2"}, []string{"final"}},
+		{"by name and index", []string{"Builder", "1"}, []string{"builder", "test"}, []string{"builder", "1"}},
+		{"same stage twice", []string{"builder", "0"}, []string{"builder"}, []string{"builder", "0"}},
+		{"unknown", []string{"guff"}, nil, nil},
+		{"one unknown", []string{"builder", "biulder"}, []string{"builder"}, []string{"builder"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			selected, matched := selectStages(stages, tt.ids)
+			if !reflect.DeepEqual(matched, tt.wantMatched) {
+				t.Errorf("selectStages() matched %v, want %v", matched, tt.wantMatched)
+			}
+
+			var got []string
+			for _, stage := range selected {
+				got = append(got, stage.ID())
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectStages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	wantLayers := []int64{0, 1, 0}
+	for i, stage := range stages {
+		if stage.Layer != wantLayers[i] {
+			t.Errorf("stage %s layer = %d, want %d", stage.ID(), stage.Layer, wantLayers[i])
+		}
+	}
+}
+
+func TestDockerfile_BaseImage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"plain", "FROM alpine:3.19\nRUN echo", "alpine:3.19"},
+		{"global arg", "ARG VERSION=18\nARG IMAGE=node:${VERSION}-alpine\nFROM $IMAGE\n", "node:18-alpine"},
+		{"arg without default", "ARG TAG\nFROM alpine:${TAG:-latest}\n", "alpine:latest"},
+		{"follows stages", "FROM golang:1.22 AS build\nFROM build AS test\nFROM test\n", "golang:1.22"},
+		{"scratch", "FROM golang AS build\nFROM scratch\nCOPY --from=build /app /app\n", ""},
+		{"platform flag", "FROM --platform=$BUILDPLATFORM ghcr.io/org/app:1 AS build\n", "ghcr.io/org/app:1"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			parsed, err := parser.Parse(strings.NewReader(tt.source))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			dockerfile := &Dockerfile{Parsed: parsed}
+			if got := dockerfile.BaseImage(); got != tt.want {
+				t.Errorf("BaseImage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
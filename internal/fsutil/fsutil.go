@@ -0,0 +1,41 @@
+// Package fsutil holds file system helpers shared by the packages that write files
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteAtomic writes content to a temporary file beside the destination and renames it into place
+// with the given mode, so readers never see a partial file and a failed write leaves nothing behind
+func WriteAtomic(path string, content []byte, mode os.FileMode) error {
+	//#nosec
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), ".stevedore-*")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = os.Remove(temp.Name())
+	}()
+
+	if _, err := temp.Write(content); err != nil {
+		_ = temp.Close()
+		return err
+	}
+
+	if err := temp.Chmod(mode); err != nil {
+		_ = temp.Close()
+		return err
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
@@ -0,0 +1,65 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteAtomic(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		existing bool
+		mode     os.FileMode
+	}{
+		{"new file in a new directory", false, 0o600},
+		{"replaces a file", true, 0o644},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := filepath.Join(t.TempDir(), "nested")
+			path := filepath.Join(dir, "Dockerfile")
+
+			if tt.existing {
+				if err := os.MkdirAll(dir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.WriteFile(path, []byte("FROM alpine\n"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := WriteAtomic(path, []byte("FROM scratch\n"), tt.mode); err != nil {
+				t.Fatalf("WriteAtomic() error = %v", err)
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(content) != "FROM scratch\n" {
+				t.Errorf("WriteAtomic() wrote %q, want %q", content, "FROM scratch\n")
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info.Mode().Perm() != tt.mode {
+				t.Errorf("WriteAtomic() wrote mode %v, want %v", info.Mode().Perm(), tt.mode)
+			}
+
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("WriteAtomic() left %d files behind, want 1", len(entries))
+			}
+		})
+	}
+}
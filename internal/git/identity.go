@@ -0,0 +1,97 @@
+package git
+
+import (
+	"os"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Identity is the name and email git would record as the author of a commit
+type Identity struct {
+	Name  string
+	Email string
+}
+
+// environment variables read, in order, when git config sets no identity
+var (
+	nameVariables  = []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"}
+	emailVariables = []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL", "EMAIL"}
+)
+
+// DefaultIdentity reads the user's identity from the global and system git config, falling back
+// to environment variables, for use outside a repository
+func DefaultIdentity() Identity {
+	return identity(userConfigs(), os.Getenv)
+}
+
+// repositoryIdentity reads the user's identity from the repository's own config, then the global
+// and system config, falling back to environment variables. No git executable is needed.
+func repositoryIdentity(repository *git.Repository) Identity {
+	var configs []*config.Config
+
+	if local, err := repository.Config(); err == nil {
+		configs = append(configs, local)
+	} else {
+		log.Debug().Msgf("unable to read repository git config: %s", err)
+	}
+
+	return identity(append(configs, userConfigs()...), os.Getenv)
+}
+
+// userConfigs loads the global and system git config, in that order
+func userConfigs() []*config.Config {
+	var configs []*config.Config
+
+	for _, scope := range []config.Scope{config.GlobalScope, config.SystemScope} {
+		cfg, err := config.LoadConfig(scope)
+		if err != nil {
+			log.Debug().Msgf("unable to read git config: %s", err)
+			continue
+		}
+
+		configs = append(configs, cfg)
+	}
+
+	return configs
+}
+
+// identity resolves the author from configs in order of precedence. As in git, author.name and
+// author.email set at any level win over user.name and user.email.
+func identity(configs []*config.Config, getenv func(string) string) Identity {
+	var authorName, authorEmail, userName, userEmail string
+
+	for _, cfg := range configs {
+		authorName = first(authorName, cfg.Author.Name)
+		authorEmail = first(authorEmail, cfg.Author.Email)
+		userName = first(userName, cfg.User.Name)
+		userEmail = first(userEmail, cfg.User.Email)
+	}
+
+	result := Identity{
+		Name:  first(authorName, userName),
+		Email: first(authorEmail, userEmail),
+	}
+
+	for _, key := range nameVariables {
+		result.Name = first(result.Name, getenv(key))
+	}
+
+	for _, key := range emailVariables {
+		result.Email = first(result.Email, getenv(key))
+	}
+
+	return result
+}
+
+// first returns the first non-empty value
+func first(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
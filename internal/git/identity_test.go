@@ -0,0 +1,58 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v5/config"
+)
+
+func TestIdentity(t *testing.T) {
+	t.Parallel()
+
+	withUser := func(name, email string) *config.Config {
+		cfg := config.NewConfig()
+		cfg.User.Name = name
+		cfg.User.Email = email
+
+		return cfg
+	}
+
+	withAuthor := func(name, email string) *config.Config {
+		cfg := config.NewConfig()
+		cfg.Author.Name = name
+		cfg.Author.Email = email
+
+		return cfg
+	}
+
+	env := map[string]string{"GIT_AUTHOR_NAME": "Env Author", "EMAIL": "env@example.com"}
+
+	tests := []struct {
+		name    string
+		configs []*config.Config
+		env     map[string]string
+		want    Identity
+	}{
+		{"repository wins", []*config.Config{withUser("Local", "local@example.com"), withUser("Global", "global@example.com")},
+			env, Identity{Name: "Local", Email: "local@example.com"}},
+		{"layered", []*config.Config{withUser("", "local@example.com"), withUser("Global", "global@example.com")},
+			env, Identity{Name: "Global", Email: "local@example.com"}},
+		{"author over user", []*config.Config{withUser("Local", "local@example.com"), withAuthor("Author", "")},
+			env, Identity{Name: "Author", Email: "local@example.com"}},
+		{"environment fallback", []*config.Config{config.NewConfig()},
+			env, Identity{Name: "Env Author", Email: "env@example.com"}},
+		{"nothing set", nil, nil, Identity{}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := identity(tt.configs, func(key string) string { return tt.env[key] })
+			if got != tt.want {
+				t.Errorf("identity() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,14 +2,14 @@ package git
 
 import (
 	"fmt"
-	"os/exec"
 	"path/filepath"
-	"strings"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/rs/zerolog/log"
 )
 
@@ -22,6 +22,13 @@ type Service interface {
 	GetRemoteURL() string
 	GetFileBlame(filePath string) (*git.BlameResult, error)
 	GetCurrentUserEmail() string
+	GetCurrentUserName() string
+	GetBranch() string
+	GetTag() string
+	GetCommitTime() (time.Time, error)
+	GetLastCommit(filePath string) (string, error)
+	GetChangedFiles() ([]string, error)
+	GetHeadContent(filePath string) ([]byte, error)
 }
 
 // GitService implements Git operations for the stevedore tool
@@ -33,7 +40,11 @@ type GitService struct {
 	organization     string
 	repoName         string
 	blameByFile      *sync.Map
-	currentUserEmail string
+	currentUser      Identity
+
+	statusOnce   sync.Once
+	changedFiles []string
+	statusErr    error
 }
 
 var gitGraphLock sync.Mutex
@@ -41,6 +52,12 @@ var gitGraphLock sync.Mutex
 // NewGitService creates a new GitService instance by walking up the directory tree
 // to find the git repository root
 func NewGitService(rootDir string) (Service, error) {
+	return NewGitServiceWithRemote(rootDir, "")
+}
+
+// NewGitServiceWithRemote creates a GitService that reads the repository's organisation, name and
+// URL from the named remote. With no name it uses origin, or failing that the first remote by name.
+func NewGitServiceWithRemote(rootDir, remote string) (Service, error) {
 	var repository *git.Repository
 	var err error
 
@@ -84,48 +101,88 @@ func NewGitService(rootDir string) (Service, error) {
 		blameByFile:      &sync.Map{},
 	}
 
-	if err := gitService.setOrgAndName(); err != nil {
+	if err := gitService.setOrgAndName(remote); err != nil {
 		return nil, err
 	}
 
-	gitService.currentUserEmail = getGitUserEmail()
+	gitService.currentUser = repositoryIdentity(repository)
 
 	return gitService, nil
 }
 
-// setOrgAndName extracts organization and repository name from git remote URL
-func (g *GitService) setOrgAndName() error {
+// setOrgAndName extracts organization and repository name from the selected remote's URL. The URL
+// is kept without credentials, and one stevedore cannot parse leaves them empty.
+func (g *GitService) setOrgAndName(name string) error {
 	// get remotes to find the repository's url
 	remotes, err := g.repository.Remotes()
 	if err != nil {
 		return fmt.Errorf("failed to get remotes: %w", err)
 	}
 
+	var candidates []*git.Remote
+
 	for _, remote := range remotes {
-		if remote.Config().Name == "origin" {
-			g.remoteURL = remote.Config().URLs[0]
-			// get endpoint structured like '/github.com/bridgecrewio/yor.git
-			endpoint, err := transport.NewEndpoint(g.remoteURL)
-			if err != nil {
-				return fmt.Errorf("failed to parse git endpoint: %w", err)
-			}
-			// remove leading '/' from path and trailing '.git. suffix, then split by '/'
-			endpointPathParts := strings.Split(strings.TrimSuffix(strings.TrimLeft(endpoint.Path, "/"), ".git"), "/")
-			if len(endpointPathParts) < 2 {
-				return fmt.Errorf("invalid format of endpoint path: %s", endpoint.Path)
-			}
-			g.organization = endpointPathParts[0]
-			g.repoName = strings.Join(endpointPathParts[1:], "/")
+		if len(remote.Config().URLs) > 0 {
+			candidates = append(candidates, remote)
+		}
+	}
 
-			break
+	if len(candidates) == 0 {
+		if name != "" {
+			return fmt.Errorf("git remote %q not found", name)
 		}
+
+		return nil
+	}
+
+	remote, err := selectRemote(candidates, name)
+	if err != nil {
+		return err
+	}
+
+	g.remoteURL = StripCredentials(remote.Config().URLs[0])
+
+	parsed, err := ParseRemote(g.remoteURL)
+	if err != nil {
+		log.Debug().Err(err).Msgf("unable to read organisation and repository from remote %s", remote.Config().Name)
+		return nil
 	}
 
+	g.organization = parsed.Org
+	g.repoName = parsed.Repo
+
 	return nil
 }
 
+// selectRemote picks the named remote, or origin, or the first remote by name
+func selectRemote(remotes []*git.Remote, name string) (*git.Remote, error) {
+	sort.Slice(remotes, func(i, j int) bool {
+		return remotes[i].Config().Name < remotes[j].Config().Name
+	})
+
+	want := name
+	if want == "" {
+		want = "origin"
+	}
+
+	for _, remote := range remotes {
+		if remote.Config().Name == want {
+			return remote, nil
+		}
+	}
+
+	if name != "" {
+		return nil, fmt.Errorf("git remote %q not found", name)
+	}
+
+	return remotes[0], nil
+}
+
 // GetCommitHash returns the current HEAD commit hash
 func (g *GitService) GetCommitHash() (string, error) {
+	gitGraphLock.Lock()
+	defer gitGraphLock.Unlock()
+
 	ref, err := g.repository.Head()
 	if err != nil {
 		return "", fmt.Errorf("failed to get HEAD: %w", err)
@@ -144,7 +201,7 @@ func (g *GitService) GetRepoName() string {
 	return g.repoName
 }
 
-// GetRemoteURL returns the git remote URL
+// GetRemoteURL returns the URL of the selected git remote, without credentials
 func (g *GitService) GetRemoteURL() string {
 	return g.remoteURL
 }
@@ -185,7 +242,7 @@ func (g *GitService) GetFileBlame(filePath string) (*git.BlameResult, error) {
 		return nil, fmt.Errorf("failed to find commit %s: %w", head.Hash().String(), err)
 	}
 
-	blameResult, err := git.Blame(selectedCommit, relativeFilePath)
+	blameResult, err := git.Blame(selectedCommit, filepath.ToSlash(relativeFilePath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get blame for latest commit of file %s: %w", filePath, err)
 	}
@@ -195,20 +252,177 @@ func (g *GitService) GetFileBlame(filePath string) (*git.BlameResult, error) {
 	return blameResult, nil
 }
 
-// GetCurrentUserEmail returns the current git user's email
-func (g *GitService) GetCurrentUserEmail() string {
-	return g.currentUserEmail
+// GetBranch returns the short name of the branch checked out, empty when HEAD is detached
+func (g *GitService) GetBranch() string {
+	gitGraphLock.Lock()
+	defer gitGraphLock.Unlock()
+
+	head, err := g.repository.Head()
+	if err != nil || !head.Name().IsBranch() {
+		return ""
+	}
+
+	return head.Name().Short()
 }
 
-// getGitUserEmail retrieves the git user email from git config
-func getGitUserEmail() string {
-	cmd := exec.Command("git", "config", "user.email")
-	email, err := cmd.Output()
+// GetTag returns the tag pointing at HEAD, lightweight or annotated, empty when there is none.
+// When several tags point at HEAD the last in name order is returned.
+func (g *GitService) GetTag() string {
+	gitGraphLock.Lock()
+	defer gitGraphLock.Unlock()
+
+	head, err := g.repository.Head()
+	if err != nil {
+		return ""
+	}
 
+	tags, err := g.repository.Tags()
 	if err != nil {
-		log.Debug().Msgf("unable to get current git user email: %s", err)
+		log.Debug().Msgf("unable to list git tags: %s", err)
 		return ""
 	}
 
-	return strings.ReplaceAll(string(email), "\n", "")
+	var names []string
+
+	_ = tags.ForEach(func(ref *plumbing.Reference) error {
+		target := ref.Hash()
+		if tag, err := g.repository.TagObject(target); err == nil {
+			target = tag.Target
+		}
+
+		if target == head.Hash() {
+			names = append(names, ref.Name().Short())
+		}
+
+		return nil
+	})
+
+	if len(names) == 0 {
+		return ""
+	}
+
+	sort.Strings(names)
+
+	return names[len(names)-1]
+}
+
+// GetCommitTime returns when the HEAD commit was committed
+func (g *GitService) GetCommitTime() (time.Time, error) {
+	gitGraphLock.Lock()
+	defer gitGraphLock.Unlock()
+
+	commit, err := g.headCommit()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return commit.Committer.When, nil
+}
+
+// GetLastCommit returns the hash of the most recent commit to change a line of the file, from its blame
+func (g *GitService) GetLastCommit(filePath string) (string, error) {
+	blame, err := g.GetFileBlame(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	var last *git.Line
+
+	for _, line := range blame.Lines {
+		if last == nil || line.Date.After(last.Date) {
+			last = line
+		}
+	}
+
+	if last == nil {
+		return "", fmt.Errorf("no commits found for %s", filePath)
+	}
+
+	return last.Hash.String(), nil
+}
+
+// GetChangedFiles returns the absolute paths of the tracked files with uncommitted changes, staged
+// or not. Untracked files are left out. The working tree is read once and the result reused.
+func (g *GitService) GetChangedFiles() ([]string, error) {
+	g.statusOnce.Do(func() {
+		gitGraphLock.Lock()
+		defer gitGraphLock.Unlock()
+
+		worktree, err := g.repository.Worktree()
+		if err != nil {
+			g.statusErr = fmt.Errorf("failed to open worktree: %w", err)
+			return
+		}
+
+		status, err := worktree.Status()
+		if err != nil {
+			g.statusErr = fmt.Errorf("failed to get worktree status: %w", err)
+			return
+		}
+
+		for path, file := range status {
+			if file.Worktree == git.Untracked || (file.Staging == git.Unmodified && file.Worktree == git.Unmodified) {
+				continue
+			}
+
+			g.changedFiles = append(g.changedFiles, filepath.Join(g.gitRootDir, filepath.FromSlash(path)))
+		}
+
+		sort.Strings(g.changedFiles)
+	})
+
+	return g.changedFiles, g.statusErr
+}
+
+// GetHeadContent returns the content of a file as committed at HEAD
+func (g *GitService) GetHeadContent(filePath string) ([]byte, error) {
+	relativeFilePath, err := g.GetRelativePath(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	gitGraphLock.Lock()
+	defer gitGraphLock.Unlock()
+
+	commit, err := g.headCommit()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := commit.File(filepath.ToSlash(relativeFilePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s at HEAD: %w", relativeFilePath, err)
+	}
+
+	content, err := file.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s at HEAD: %w", relativeFilePath, err)
+	}
+
+	return []byte(content), nil
+}
+
+// headCommit returns the commit HEAD points at; callers hold gitGraphLock
+func (g *GitService) headCommit() (*object.Commit, error) {
+	head, err := g.repository.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	commit, err := g.repository.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find commit %s: %w", head.Hash().String(), err)
+	}
+
+	return commit, nil
+}
+
+// GetCurrentUserEmail returns the current git user's email
+func (g *GitService) GetCurrentUserEmail() string {
+	return g.currentUser.Email
+}
+
+// GetCurrentUserName returns the current git user's name
+func (g *GitService) GetCurrentUserName() string {
+	return g.currentUser.Name
 }
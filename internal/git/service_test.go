@@ -0,0 +1,272 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// newTestRepo creates a repository with two commits, the second tagged, and returns its
+// directory with the hashes of both commits
+func newTestRepo(t *testing.T) (string, string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	repository, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worktree, err := repository.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit := func(message string, when time.Time, files map[string]string) string {
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := worktree.Add(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		hash, err := worktree.Commit(message, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: when},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return hash.String()
+	}
+
+	first := commit("first", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), map[string]string{
+		"Dockerfile": "FROM alpine\n",
+		"README.md":  "readme\n",
+	})
+	second := commit("second", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), map[string]string{
+		"README.md": "changed\n",
+	})
+
+	head, err := repository.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repository.CreateTag("v1.0.0", head.Hash(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repository.CreateTag("v1.1.0", head.Hash(), &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		Message: "release",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, first, second
+}
+
+func TestGitService_metadata(t *testing.T) {
+	t.Parallel()
+
+	dir, first, _ := newTestRepo(t)
+
+	service, err := NewGitService(dir)
+	if err != nil {
+		t.Fatalf("NewGitService() error = %v", err)
+	}
+
+	if got := service.GetBranch(); got != "master" {
+		t.Errorf("GetBranch() = %q, want master", got)
+	}
+
+	if got := service.GetTag(); got != "v1.1.0" {
+		t.Errorf("GetTag() = %q, want v1.1.0", got)
+	}
+
+	commitTime, err := service.GetCommitTime()
+	if err != nil || !commitTime.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("GetCommitTime() = %v, %v, want 2024-02-01", commitTime, err)
+	}
+
+	lastCommit, err := service.GetLastCommit(filepath.Join(dir, "Dockerfile"))
+	if err != nil || lastCommit != first {
+		t.Errorf("GetLastCommit() = %q, %v, want %q", lastCommit, err, first)
+	}
+
+	content, err := service.GetHeadContent(filepath.Join(dir, "README.md"))
+	if err != nil || string(content) != "changed\n" {
+		t.Errorf("GetHeadContent() = %q, %v, want changed", content, err)
+	}
+
+	if _, err := service.GetHeadContent(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("GetHeadContent() error = nil for a file not at HEAD")
+	}
+}
+
+func TestGitService_detached(t *testing.T) {
+	t.Parallel()
+
+	dir, first, _ := newTestRepo(t)
+
+	repository, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worktree, err := repository.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(first)}); err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := NewGitService(dir)
+	if err != nil {
+		t.Fatalf("NewGitService() error = %v", err)
+	}
+
+	if got := service.GetBranch(); got != "" {
+		t.Errorf("GetBranch() = %q, want empty when detached", got)
+	}
+
+	if got := service.GetTag(); got != "" {
+		t.Errorf("GetTag() = %q, want empty for an untagged commit", got)
+	}
+}
+
+func TestGitService_GetChangedFiles(t *testing.T) {
+	t.Parallel()
+
+	dir, _, _ := newTestRepo(t)
+
+	files := map[string]string{
+		"Dockerfile": "FROM alpine\nRUN true\n",
+		"untracked":  "new\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	service, err := NewGitService(dir)
+	if err != nil {
+		t.Fatalf("NewGitService() error = %v", err)
+	}
+
+	got, err := service.GetChangedFiles()
+	if err != nil {
+		t.Fatalf("GetChangedFiles() error = %v", err)
+	}
+
+	if want := []string{filepath.Join(dir, "Dockerfile")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChangedFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestNewGitServiceWithRemote(t *testing.T) {
+	t.Parallel()
+
+	dir, _, _ := newTestRepo(t)
+
+	repository, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, remote := range map[string]string{
+		"upstream": "https://token@gitlab.com/acme/platform/widget.git",
+		"mirror":   "git@github.com:mirror/widget.git",
+	} {
+		if _, err := repository.CreateRemote(&config.RemoteConfig{Name: name, URLs: []string{remote}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		org     string
+		url     string
+		wantErr bool
+	}{
+		{"first by name without origin", "", "mirror", "git@github.com:mirror/widget.git", false},
+		{"named", "upstream", "acme/platform", "https://gitlab.com/acme/platform/widget.git", false},
+		{"missing", "origin", "", "", true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			service, err := NewGitServiceWithRemote(dir, tt.remote)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewGitServiceWithRemote() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got := service.GetOrganization(); got != tt.org {
+				t.Errorf("GetOrganization() = %q, want %q", got, tt.org)
+			}
+
+			if got := service.GetRemoteURL(); got != tt.url {
+				t.Errorf("GetRemoteURL() = %q, want %q", got, tt.url)
+			}
+		})
+	}
+}
+
+func TestGitService_currentUser(t *testing.T) {
+	t.Parallel()
+
+	dir, _, _ := newTestRepo(t)
+
+	repository, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := repository.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.User.Name = "Repo User"
+	cfg.User.Email = "repo@example.com"
+
+	if err := repository.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := NewGitService(dir)
+	if err != nil {
+		t.Fatalf("NewGitService() error = %v", err)
+	}
+
+	if got := service.GetCurrentUserName(); got != "Repo User" {
+		t.Errorf("GetCurrentUserName() = %q, want Repo User", got)
+	}
+
+	if got := service.GetCurrentUserEmail(); got != "repo@example.com" {
+		t.Errorf("GetCurrentUserEmail() = %q, want repo@example.com", got)
+	}
+}
@@ -0,0 +1,170 @@
+package git
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// Remote is a git remote URL broken into the parts stevedore records
+type Remote struct {
+	Host string
+	// Org is the namespace holding the repository: an owner, a GitLab group with its subgroups,
+	// an Azure DevOps organisation and project, or a Bitbucket Server project
+	Org  string
+	Repo string
+	// Source is a browsable https URL for the repository, without credentials
+	Source string
+}
+
+// ParseRemote reads the host, namespace and repository from a remote URL, in URL or scp-like
+// form, knowing the path shapes of GitLab subgroups, Azure DevOps and Bitbucket Server
+func ParseRemote(remoteURL string) (Remote, error) {
+	endpoint, err := transport.NewEndpoint(remoteURL)
+	if err != nil {
+		return Remote{}, fmt.Errorf("failed to parse git remote: %w", err)
+	}
+
+	if endpoint.Protocol == "file" || endpoint.Host == "" {
+		return Remote{}, fmt.Errorf("git remote %s is not hosted", StripCredentials(remoteURL))
+	}
+
+	host := endpoint.Host
+	// the port of an ssh remote is not the port of the web interface
+	if endpoint.Port != 0 && strings.HasPrefix(endpoint.Protocol, "http") {
+		host = fmt.Sprintf("%s:%d", host, endpoint.Port)
+	}
+
+	segments := strings.Split(strings.TrimSuffix(strings.Trim(endpoint.Path, "/"), ".git"), "/")
+
+	var remote Remote
+
+	switch {
+	case endpoint.Host == "ssh.dev.azure.com" || (strings.HasPrefix(endpoint.Host, "vs-ssh.") &&
+		strings.HasSuffix(endpoint.Host, ".visualstudio.com")):
+		remote, err = azureSSHRemote(segments)
+	case slices.Index(segments, "_git") > 0:
+		remote, err = azureRemote(host, segments)
+	case slices.Index(segments, "scm") >= 0:
+		remote, err = bitbucketServerRemote(host, segments)
+	default:
+		remote, err = pathRemote(host, segments)
+	}
+
+	if err != nil {
+		return Remote{}, err
+	}
+
+	remote.Host = endpoint.Host
+
+	return remote, nil
+}
+
+// azureRemote reads an Azure DevOps https remote, org/project/_git/repo, or on a server
+// collection/project/_git/repo
+func azureRemote(host string, segments []string) (Remote, error) {
+	index := slices.Index(segments, "_git")
+	if index != len(segments)-2 {
+		return Remote{}, fmt.Errorf("invalid format of Azure DevOps path: %s", strings.Join(segments, "/"))
+	}
+
+	return Remote{
+		Org:    strings.Join(segments[:index], "/"),
+		Repo:   segments[index+1],
+		Source: "https://" + host + "/" + strings.Join(segments, "/"),
+	}, nil
+}
+
+// azureSSHRemote reads an Azure DevOps ssh remote, v3/org/project/repo
+func azureSSHRemote(segments []string) (Remote, error) {
+	if len(segments) != 4 || segments[0] != "v3" {
+		return Remote{}, fmt.Errorf("invalid format of Azure DevOps ssh path: %s", strings.Join(segments, "/"))
+	}
+
+	org, project, repo := segments[1], segments[2], segments[3]
+
+	return Remote{
+		Org:    org + "/" + project,
+		Repo:   repo,
+		Source: "https://dev.azure.com/" + org + "/" + project + "/_git/" + repo,
+	}, nil
+}
+
+// bitbucketServerRemote reads a Bitbucket Server clone URL, [context/]scm/project/repo, where
+// a project starting with ~ is a user's personal project
+func bitbucketServerRemote(host string, segments []string) (Remote, error) {
+	index := slices.Index(segments, "scm")
+	if index != len(segments)-3 {
+		return Remote{}, fmt.Errorf("invalid format of Bitbucket Server path: %s", strings.Join(segments, "/"))
+	}
+
+	base := "https://" + host + "/" + strings.Join(segments[:index], "/")
+	project, repo := segments[index+1], segments[index+2]
+
+	source := strings.TrimSuffix(base, "/") + "/projects/" + project + "/repos/" + repo
+	if user, ok := strings.CutPrefix(project, "~"); ok {
+		source = strings.TrimSuffix(base, "/") + "/users/" + user + "/repos/" + repo
+	}
+
+	return Remote{Org: project, Repo: repo, Source: source}, nil
+}
+
+// pathRemote reads a remote whose path is the namespace followed by the repository, which may
+// nest groups as GitLab does
+func pathRemote(host string, segments []string) (Remote, error) {
+	if len(segments) < 2 || slices.Index(segments, "") >= 0 {
+		return Remote{}, fmt.Errorf("invalid format of endpoint path: %s", strings.Join(segments, "/"))
+	}
+
+	last := len(segments) - 1
+
+	return Remote{
+		Org:    strings.Join(segments[:last], "/"),
+		Repo:   segments[last],
+		Source: "https://" + host + "/" + strings.Join(segments, "/"),
+	}, nil
+}
+
+// SourceURL converts a git remote URL, such as git@github.com:org/repo.git, into a browsable https URL
+func SourceURL(remoteURL string) string {
+	if remoteURL == "" {
+		return ""
+	}
+
+	remote, err := ParseRemote(remoteURL)
+	if err != nil {
+		return ""
+	}
+
+	return remote.Source
+}
+
+// StripCredentials removes any password, and the user of an http remote, where access tokens
+// are usually passed, so a remote URL is safe to record. The user of an ssh remote is kept. The
+// URL is not parsed, so a token that is not valid in a URL is removed all the same.
+func StripCredentials(remoteURL string) string {
+	scheme, rest, ok := strings.Cut(remoteURL, "://")
+	if !ok {
+		return remoteURL
+	}
+
+	authority := rest
+	if end := strings.IndexAny(rest, "/?#"); end >= 0 {
+		authority = rest[:end]
+	}
+
+	at := strings.LastIndex(authority, "@")
+	if at < 0 {
+		return remoteURL
+	}
+
+	user := ""
+	if !strings.HasPrefix(strings.ToLower(scheme), "http") {
+		name, _, _ := strings.Cut(authority[:at], ":")
+		user = name + "@"
+	}
+
+	return scheme + "://" + user + rest[at+1:]
+}
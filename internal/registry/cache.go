@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jameswoolfenden/stevedore/internal/fsutil"
+)
+
+// ErrNotCached is returned in offline mode when a manifest or blob is not in the cache
+var ErrNotCached = errors.New("not in the registry cache")
+
+// Cache stores manifests and config blobs on disk by digest, along with the digest each tag last
+// resolved to. Content is only ever read back if it still matches its digest.
+type Cache struct {
+	Dir string
+}
+
+// DefaultCacheDir returns the stevedore directory under the user cache directory
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user cache directory: %w", err)
+	}
+
+	return filepath.Join(dir, "stevedore"), nil
+}
+
+// NewCache creates a cache rooted at dir, which is created on first write
+func NewCache(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// Get reads content by digest, reporting false when it is missing or no longer matches
+func (c *Cache) Get(digest string) ([]byte, bool) {
+	path, err := c.blobPath(digest)
+	if err != nil {
+		return nil, false
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	if err := verifyDigest(content, digest); err != nil {
+		return nil, false
+	}
+
+	return content, true
+}
+
+// Put stores content under its digest
+func (c *Cache) Put(digest string, content []byte) error {
+	path, err := c.blobPath(digest)
+	if err != nil {
+		return err
+	}
+
+	return writeCacheFile(path, content)
+}
+
+// GetTag returns the digest a tag last resolved to
+func (c *Cache) GetTag(ref Reference) (string, bool) {
+	content, err := os.ReadFile(c.tagPath(ref))
+	if err != nil {
+		return "", false
+	}
+
+	digest := strings.TrimSpace(string(content))
+
+	return digest, digestPattern.MatchString(digest)
+}
+
+// PutTag records the digest a tag resolved to
+func (c *Cache) PutTag(ref Reference, digest string) error {
+	return writeCacheFile(c.tagPath(ref), []byte(digest+"\n"))
+}
+
+// blobPath returns where content with the digest is stored, rejecting malformed digests
+func (c *Cache) blobPath(digest string) (string, error) {
+	algorithm, hash, ok := strings.Cut(digest, ":")
+	if !ok || !digestPattern.MatchString(digest) {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+
+	return filepath.Join(c.Dir, "blobs", algorithm, hash), nil
+}
+
+// tagPath returns where the digest of a tag is recorded; the port separator is replaced so the
+// path is valid on every platform
+func (c *Cache) tagPath(ref Reference) string {
+	registry := strings.ReplaceAll(ref.Registry, ":", "_")
+
+	return filepath.Join(c.Dir, "tags", registry, filepath.FromSlash(ref.Repository), ref.Tag)
+}
+
+// writeCacheFile writes a cache file atomically, so readers never see a partial file
+func writeCacheFile(path string, content []byte) error {
+	if err := fsutil.WriteAtomic(path, content, 0o600); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jameswoolfenden/stevedore/internal/auth"
+)
+
+func TestClient_Cache(t *testing.T) {
+	t.Parallel()
+
+	config := `{"config":{"Labels":{"layer.0.author":"cached"}}}`
+	manifest := mustJSON(t, map[string]interface{}{
+		"mediaType": mediaTypeOCIManifest,
+		"config":    map[string]string{"digest": digestOf(config)},
+	})
+
+	server, client := newTestRegistry(t, map[string]string{
+		"/v2/org/app/manifests/2.0":             manifest,
+		"/v2/org/app/blobs/" + digestOf(config): config,
+	})
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	cache := NewCache(t.TempDir())
+	client.Cache = cache
+
+	ref, err := ParseReference(host + "/org/app:2.0")
+	if err != nil {
+		t.Fatalf("ParseReference() error = %v", err)
+	}
+
+	online, err := client.GetImage(ref)
+	if err != nil {
+		t.Fatalf("GetImage() error = %v", err)
+	}
+
+	server.Close()
+
+	offline := NewClient(auth.NewDockerAuthWithClient(server.Client()), server.Client())
+	offline.Cache = cache
+	offline.Offline = true
+
+	got, err := offline.GetImage(ref)
+	if err != nil {
+		t.Fatalf("GetImage() offline error = %v", err)
+	}
+
+	if got.Digest != online.Digest || got.Labels["layer.0.author"] != "cached" {
+		t.Errorf("GetImage() offline = %+v, want %+v", got, online)
+	}
+
+	missing := ref
+	missing.Tag = "3.0"
+
+	if _, err := offline.GetImage(missing); !errors.Is(err, ErrNotCached) {
+		t.Errorf("GetImage() offline for an uncached tag error = %v, want ErrNotCached", err)
+	}
+}
+
+func TestCache_GetRejectsCorruptContent(t *testing.T) {
+	t.Parallel()
+
+	cache := NewCache(t.TempDir())
+	digest := digestOf("content")
+
+	if err := cache.Put(digest, []byte("content")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if got, ok := cache.Get(digest); !ok || string(got) != "content" {
+		t.Errorf("Get() = %q, %v, want the stored content", got, ok)
+	}
+
+	path, _ := cache.blobPath(digest)
+	if err := os.WriteFile(path, []byte("tampered"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := cache.Get(digest); ok {
+		t.Errorf("Get() returned content that does not match its digest")
+	}
+
+	if err := cache.Put("sha256:../../etc", []byte("x")); err == nil {
+		t.Errorf("Put() accepted a digest that escapes the cache")
+	}
+}
@@ -0,0 +1,451 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/jameswoolfenden/stevedore/internal/auth"
+	"github.com/rs/zerolog/log"
+)
+
+// Client reads manifests from any registry implementing the OCI distribution API
+type Client struct {
+	// Platform selects the manifest to read from multi-arch images
+	Platform Platform
+	// Cache keeps manifests and blobs on disk between runs when set
+	Cache *Cache
+	// Offline answers every lookup from the cache without contacting registries
+	Offline bool
+
+	authService auth.DockerAuth
+	httpClient  *http.Client
+
+	mu        sync.Mutex
+	manifests map[string]*Manifest
+	// authorizations holds the last Authorization accepted for each registry and repository, sent
+	// up front so a lookup costs one round trip instead of a challenge and a retry
+	authorizations map[string]string
+}
+
+// Manifest is a manifest document as served by a registry
+type Manifest struct {
+	MediaType string
+	Digest    string
+	Body      []byte
+}
+
+// NewClient creates a registry client that authenticates with the given service
+func NewClient(authService auth.DockerAuth, httpClient *http.Client) *Client {
+	return &Client{
+		Platform:       DefaultPlatform,
+		authService:    authService,
+		httpClient:     httpClient,
+		manifests:      make(map[string]*Manifest),
+		authorizations: make(map[string]string),
+	}
+}
+
+// GetManifest fetches the manifest for the reference's digest, or for its tag when it has no digest.
+// Each reference is fetched once per run, and manifests addressed by digest come from the disk
+// cache when they are in it.
+func (c *Client) GetManifest(ref Reference) (*Manifest, error) {
+	key := ref.String()
+
+	c.mu.Lock()
+	manifest, ok := c.manifests[key]
+	c.mu.Unlock()
+
+	if ok {
+		return manifest, nil
+	}
+
+	manifest, err := c.loadManifest(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.manifests[key] = manifest
+	c.mu.Unlock()
+
+	return manifest, nil
+}
+
+// loadManifest reads a manifest from the disk cache when it can, otherwise from the registry
+func (c *Client) loadManifest(ref Reference) (*Manifest, error) {
+	if manifest, ok := c.cachedManifest(ref); ok {
+		return manifest, nil
+	}
+
+	if c.Offline {
+		return nil, fmt.Errorf("manifest for %s: %w", ref, ErrNotCached)
+	}
+
+	manifest, err := c.fetchManifest(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Cache != nil {
+		if err := c.Cache.Put(manifest.Digest, manifest.Body); err != nil {
+			log.Warn().Err(err).Msgf("failed to cache manifest for %s", ref)
+		} else if ref.Digest == "" {
+			if err := c.Cache.PutTag(ref, manifest.Digest); err != nil {
+				log.Warn().Err(err).Msgf("failed to cache tag for %s", ref)
+			}
+		}
+	}
+
+	return manifest, nil
+}
+
+// cachedManifest looks a manifest up in the disk cache. Tags can move, so the digest a tag last
+// resolved to is only trusted offline.
+func (c *Client) cachedManifest(ref Reference) (*Manifest, bool) {
+	if c.Cache == nil {
+		return nil, false
+	}
+
+	digest := ref.Digest
+	if digest == "" {
+		if !c.Offline {
+			return nil, false
+		}
+
+		var ok bool
+		if digest, ok = c.Cache.GetTag(ref); !ok {
+			return nil, false
+		}
+	}
+
+	body, ok := c.Cache.Get(digest)
+	if !ok {
+		return nil, false
+	}
+
+	return &Manifest{Digest: digest, Body: body}, true
+}
+
+// fetchManifest requests a manifest from the registry
+func (c *Client) fetchManifest(ref Reference) (*Manifest, error) {
+	res, err := c.get(ref, "/manifests/"+ref.Identifier(), manifestMediaTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeBody(res)
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	digest := res.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		sum := sha256.Sum256(body)
+		digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	return &Manifest{
+		MediaType: strings.TrimSpace(strings.Split(res.Header.Get("Content-Type"), ";")[0]),
+		Digest:    digest,
+		Body:      body,
+	}, nil
+}
+
+// Image is what stevedore reads about an image from its registry
+type Image struct {
+	Reference Reference
+	// Digest is the digest the reference resolves to, the index digest for a multi-arch image
+	Digest string
+	// PlatformDigest is the digest of the image manifest for the client's platform
+	PlatformDigest string
+	Labels         map[string]string
+}
+
+// resolveManifest fetches the manifest for the reference, then follows an index or manifest list
+// to the image manifest for the client's platform
+func (c *Client) resolveManifest(ref Reference) (*Manifest, *Manifest, *manifestDocument, error) {
+	top, err := c.GetManifest(ref)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	document, err := parseManifest(top)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if !document.isIndex() {
+		return top, top, document, nil
+	}
+
+	descriptor, err := document.selectManifest(c.Platform)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: %w", ref, err)
+	}
+
+	platformRef := ref
+	platformRef.Digest = descriptor.Digest
+
+	manifest, err := c.GetManifest(platformRef)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	document, err = parseManifest(manifest)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return top, manifest, document, nil
+}
+
+// GetImage resolves a reference to its digests and reads the labels from its image config
+func (c *Client) GetImage(ref Reference) (*Image, error) {
+	top, manifest, document, err := c.resolveManifest(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := c.configLabels(ref, document)
+	if err != nil {
+		return nil, err
+	}
+
+	image := &Image{
+		Reference:      ref,
+		Digest:         top.Digest,
+		PlatformDigest: manifest.Digest,
+		Labels:         make(map[string]string, len(labels)),
+	}
+
+	for key, value := range labels {
+		image.Labels[key] = fmt.Sprint(value)
+	}
+
+	return image, nil
+}
+
+// GetLabels retrieves the labels of an image from its config blob, or from the history of a
+// schema 1 manifest when that is all the registry serves
+func (c *Client) GetLabels(ref Reference) (map[string]interface{}, error) {
+	_, _, document, err := c.resolveManifest(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.configLabels(ref, document)
+}
+
+// configLabels reads the labels from the config blob an image manifest points at
+func (c *Client) configLabels(ref Reference, document *manifestDocument) (map[string]interface{}, error) {
+	if document.Config == nil {
+		return labelsFromHistory(document)
+	}
+
+	blob, err := c.GetBlob(ref, document.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	var config imageConfig
+	if err := json.Unmarshal(blob, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal image config: %w", err)
+	}
+
+	log.Debug().Interface("labels", config.Config.Labels).Msgf("fetched image config for %s", ref)
+
+	return config.Config.Labels, nil
+}
+
+// GetBlob fetches a blob from the reference's repository and checks it against its digest,
+// using the disk cache when there is one
+func (c *Client) GetBlob(ref Reference, digest string) ([]byte, error) {
+	if c.Cache != nil {
+		if blob, ok := c.Cache.Get(digest); ok {
+			return blob, nil
+		}
+	}
+
+	if c.Offline {
+		return nil, fmt.Errorf("blob %s of %s: %w", digest, ref, ErrNotCached)
+	}
+
+	blob, err := c.fetchBlob(ref, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Cache != nil {
+		if err := c.Cache.Put(digest, blob); err != nil {
+			log.Warn().Err(err).Msgf("failed to cache blob %s", digest)
+		}
+	}
+
+	return blob, nil
+}
+
+// fetchBlob requests a blob from the registry and checks it against its digest
+func (c *Client) fetchBlob(ref Reference, digest string) ([]byte, error) {
+	res, err := c.get(ref, "/blobs/"+digest, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeBody(res)
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if err := verifyDigest(body, digest); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// parseManifest decodes a manifest document
+func parseManifest(manifest *Manifest) (*manifestDocument, error) {
+	var document manifestDocument
+	if err := json.Unmarshal(manifest.Body, &document); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
+	}
+
+	if document.MediaType == "" {
+		document.MediaType = manifest.MediaType
+	}
+
+	return &document, nil
+}
+
+// verifyDigest checks content against a sha256 digest; other algorithms are not checked
+func verifyDigest(content []byte, digest string) error {
+	algorithm, hash, _ := strings.Cut(digest, ":")
+	if algorithm != "sha256" {
+		return nil
+	}
+
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != hash {
+		return fmt.Errorf("content does not match digest %s", digest)
+	}
+
+	return nil
+}
+
+// labelsFromHistory extracts labels from the v1Compatibility entry of a schema 1 manifest
+func labelsFromHistory(document *manifestDocument) (map[string]interface{}, error) {
+	if len(document.History) == 0 {
+		log.Debug().Msg("no history entry in manifest")
+		return nil, nil
+	}
+
+	var config imageConfig
+	if err := json.Unmarshal([]byte(document.History[0].V1Compatibility), &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal v1Compatibility: %w", err)
+	}
+
+	if config.Config.Labels != nil {
+		return config.Config.Labels, nil
+	}
+
+	return config.ContainerConfig.Labels, nil
+}
+
+// get requests a path under the repository with the authorization last used for it, answering an
+// authentication challenge if the registry sends one
+func (c *Client) get(ref Reference, path string, accept []string) (*http.Response, error) {
+	url := "https://" + ref.APIHost() + "/v2/" + ref.Repository + path
+	key := ref.Registry + "/" + ref.Repository
+
+	c.mu.Lock()
+	authorization := c.authorizations[key]
+	c.mu.Unlock()
+
+	res, err := c.do(url, accept, authorization)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusUnauthorized {
+		header := res.Header.Get("WWW-Authenticate")
+		closeBody(res)
+
+		authorization, err = c.authorize(ref, header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to authenticate with %s: %w", ref.Registry, err)
+		}
+
+		res, err = c.do(url, accept, authorization)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.StatusCode != http.StatusUnauthorized {
+			c.mu.Lock()
+			c.authorizations[key] = authorization
+			c.mu.Unlock()
+		}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		closeBody(res)
+		return nil, fmt.Errorf("unexpected status code %d from %s", res.StatusCode, url)
+	}
+
+	return res, nil
+}
+
+// authorize answers a WWW-Authenticate challenge with an Authorization header value
+func (c *Client) authorize(ref Reference, header string) (string, error) {
+	challenge, err := auth.ParseChallenge(header)
+	if err != nil {
+		return "", err
+	}
+
+	challenge.Registry = ref.Registry
+	if challenge.Scope == "" {
+		challenge.Scope = "repository:" + ref.Repository + ":pull"
+	}
+
+	return c.authService.Authorize(challenge)
+}
+
+// do executes a GET request with the given accept headers and optional authorization
+func (c *Client) do(url string, accept []string, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for _, mediaType := range accept {
+		req.Header.Add("accept", mediaType)
+	}
+
+	if authorization != "" {
+		req.Header.Add("Authorization", authorization)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute http request: %w", err)
+	}
+
+	return res, nil
+}
+
+// closeBody closes a response body, logging any failure
+func closeBody(res *http.Response) {
+	if closeErr := res.Body.Close(); closeErr != nil {
+		log.Warn().Err(closeErr).Msg("failed to close http response body")
+	}
+}
@@ -0,0 +1,211 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jameswoolfenden/stevedore/internal/auth"
+)
+
+// newTestRegistry starts a registry stand-in that requires a bearer token from its own realm
+func newTestRegistry(t *testing.T, routes map[string]string) (*httptest.Server, *Client) {
+	t.Helper()
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("service") != "test-registry" || r.URL.Query().Get("scope") != "repository:org/app:pull" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"access_token":"secret"}`))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test-registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		body, ok := routes[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Docker-Content-Digest", digestOf(body))
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClient(auth.NewDockerAuthWithClient(server.Client()), server.Client())
+
+	return server, client
+}
+
+// digestOf returns the sha256 digest of content
+func digestOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// mustJSON marshals a test document
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestClient_GetLabels(t *testing.T) {
+	t.Parallel()
+
+	history := mustJSON(t, map[string]interface{}{
+		"container_config": map[string]interface{}{"Labels": map[string]string{"layer.0.author": "James Woolfenden"}},
+	})
+	schema1 := mustJSON(t, map[string]interface{}{
+		"history": []map[string]string{{"v1Compatibility": history}},
+	})
+
+	amdConfig := mustJSON(t, map[string]interface{}{
+		"architecture": "amd64",
+		"config":       map[string]interface{}{"Labels": map[string]string{"layer.1.author": "amd64"}},
+	})
+	armConfig := mustJSON(t, map[string]interface{}{
+		"architecture": "arm64",
+		"config":       map[string]interface{}{"Labels": map[string]string{"layer.1.author": "arm64"}},
+	})
+	amdManifest := mustJSON(t, map[string]interface{}{
+		"mediaType": mediaTypeOCIManifest,
+		"config":    map[string]string{"mediaType": "application/vnd.oci.image.config.v1+json", "digest": digestOf(amdConfig)},
+	})
+	armManifest := mustJSON(t, map[string]interface{}{
+		"mediaType": mediaTypeDockerManifest,
+		"config":    map[string]string{"mediaType": "application/vnd.docker.container.image.v1+json", "digest": digestOf(armConfig)},
+	})
+	index := mustJSON(t, map[string]interface{}{
+		"mediaType": mediaTypeOCIIndex,
+		"manifests": []map[string]interface{}{
+			{"digest": digestOf(armManifest), "platform": map[string]string{"os": "linux", "architecture": "arm64", "variant": "v8"}},
+			{"digest": digestOf(amdManifest), "platform": map[string]string{"os": "linux", "architecture": "amd64"}},
+			{"digest": "sha256:0000", "platform": map[string]string{"os": "unknown", "architecture": "unknown"}},
+		},
+	})
+	tampered := mustJSON(t, map[string]interface{}{
+		"config": map[string]string{"digest": digestOf("something else")},
+	})
+
+	server, client := newTestRegistry(t, map[string]string{
+		"/v2/org/app/manifests/1.0":                       schema1,
+		"/v2/org/app/manifests/2.0":                       index,
+		"/v2/org/app/manifests/single":                    amdManifest,
+		"/v2/org/app/manifests/tampered":                  tampered,
+		"/v2/org/app/manifests/" + digestOf(amdManifest):  amdManifest,
+		"/v2/org/app/manifests/" + digestOf(armManifest):  armManifest,
+		"/v2/org/app/blobs/" + digestOf(amdConfig):        amdConfig,
+		"/v2/org/app/blobs/" + digestOf(armConfig):        armConfig,
+		"/v2/org/app/blobs/" + digestOf("something else"): amdConfig,
+	})
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	armClient := NewClient(auth.NewDockerAuthWithClient(server.Client()), server.Client())
+	armClient.Platform = Platform{OS: "linux", Architecture: "arm64"}
+
+	windowsClient := NewClient(auth.NewDockerAuthWithClient(server.Client()), server.Client())
+	windowsClient.Platform = Platform{OS: "windows", Architecture: "amd64"}
+
+	tests := []struct {
+		name    string
+		client  *Client
+		image   string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{"schema 1 history", client, host + "/org/app:1.0", map[string]interface{}{"layer.0.author": "James Woolfenden"}, false},
+		{"index", client, host + "/org/app:2.0", map[string]interface{}{"layer.1.author": "amd64"}, false},
+		{"index for platform", armClient, host + "/org/app:2.0", map[string]interface{}{"layer.1.author": "arm64"}, false},
+		{"index without platform", windowsClient, host + "/org/app:2.0", nil, true},
+		{"single manifest", client, host + "/org/app:single", map[string]interface{}{"layer.1.author": "amd64"}, false},
+		{"digest mismatch", client, host + "/org/app:tampered", nil, true},
+		{"unknown tag", client, host + "/org/app:3.0", nil, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ref, err := ParseReference(tt.image)
+			if err != nil {
+				t.Fatalf("ParseReference() error = %v", err)
+			}
+
+			got, err := tt.client.GetLabels(ref)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetLabels() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_reusesAuthorization(t *testing.T) {
+	t.Parallel()
+
+	manifest := mustJSON(t, map[string]interface{}{"mediaType": mediaTypeOCIManifest})
+
+	var challenges atomic.Int32
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			_, _ = w.Write([]byte(`{"access_token":"secret"}`))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			challenges.Add(1)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test-registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Docker-Content-Digest", digestOf(manifest))
+		_, _ = w.Write([]byte(manifest))
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClient(auth.NewDockerAuthWithClient(server.Client()), server.Client())
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	for _, image := range []string{host + "/org/app:1.0", host + "/org/app:2.0"} {
+		ref, err := ParseReference(image)
+		if err != nil {
+			t.Fatalf("ParseReference() error = %v", err)
+		}
+
+		if _, err := client.GetManifest(ref); err != nil {
+			t.Fatalf("GetManifest() error = %v", err)
+		}
+	}
+
+	if got := challenges.Load(); got != 1 {
+		t.Errorf("registry challenged %d requests, want only the first", got)
+	}
+}
@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	mediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerSchema1  = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+	mediaTypeJSON           = "application/json"
+)
+
+// manifestMediaTypes are the manifest formats stevedore accepts, most preferred first
+var manifestMediaTypes = []string{
+	mediaTypeOCIIndex,
+	mediaTypeOCIManifest,
+	mediaTypeDockerManifest,
+	mediaTypeDockerList,
+	mediaTypeDockerSchema1,
+	mediaTypeJSON,
+}
+
+// Platform identifies the operating system and CPU an image manifest was built for
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// DefaultPlatform is the platform chosen from multi-arch images when none is given
+var DefaultPlatform = Platform{OS: "linux", Architecture: "amd64"}
+
+// Descriptor points at a manifest or blob by digest
+type Descriptor struct {
+	MediaType string    `json:"mediaType"`
+	Digest    string    `json:"digest"`
+	Size      int64     `json:"size"`
+	Platform  *Platform `json:"platform,omitempty"`
+}
+
+// manifestDocument holds the fields of the manifest formats stevedore reads: an index or manifest
+// list has Manifests, an image manifest has Config and a schema 1 manifest has History
+type manifestDocument struct {
+	MediaType string       `json:"mediaType"`
+	Manifests []Descriptor `json:"manifests"`
+	Config    *Descriptor  `json:"config"`
+	History   []struct {
+		V1Compatibility string `json:"v1Compatibility"`
+	} `json:"history"`
+}
+
+// imageConfig is the part of an image config blob that holds its labels
+type imageConfig struct {
+	Config struct {
+		Labels map[string]interface{} `json:"Labels"`
+	} `json:"config"`
+	ContainerConfig struct {
+		Labels map[string]interface{} `json:"Labels"`
+	} `json:"container_config"`
+}
+
+// ParsePlatform parses a platform in the os/arch[/variant] form used by docker build --platform
+func ParsePlatform(platform string) (Platform, error) {
+	parts := strings.Split(strings.TrimSpace(platform), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", platform)
+	}
+
+	result := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		result.Variant = parts[2]
+	}
+
+	return result, nil
+}
+
+// String returns the platform in os/arch[/variant] form
+func (p Platform) String() string {
+	if p.Variant == "" {
+		return p.OS + "/" + p.Architecture
+	}
+
+	return p.OS + "/" + p.Architecture + "/" + p.Variant
+}
+
+// matches reports whether a manifest built for other can run on this platform. A platform
+// without a variant accepts any variant.
+func (p Platform) matches(other *Platform) bool {
+	if other == nil || other.OS != p.OS || other.Architecture != p.Architecture {
+		return false
+	}
+
+	return p.Variant == "" || p.Variant == other.Variant
+}
+
+// isIndex reports whether the document lists per-platform manifests
+func (m *manifestDocument) isIndex() bool {
+	return m.MediaType == mediaTypeOCIIndex || m.MediaType == mediaTypeDockerList || len(m.Manifests) > 0
+}
+
+// selectManifest picks the manifest for a platform from an index or manifest list
+func (m *manifestDocument) selectManifest(platform Platform) (Descriptor, error) {
+	for _, manifest := range m.Manifests {
+		if platform.matches(manifest.Platform) {
+			return manifest, nil
+		}
+	}
+
+	return Descriptor{}, fmt.Errorf("no manifest for platform %s", platform)
+}
@@ -0,0 +1,128 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DockerHub is the canonical name of the default registry
+	DockerHub = "docker.io"
+	// dockerHubAPI is the host that serves the Docker Hub registry API
+	dockerHubAPI = "registry-1.docker.io"
+)
+
+// digestPattern matches a content digest such as sha256:<hex>
+var digestPattern = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
+
+// repositoryPattern matches the path components of a repository name
+var repositoryPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+
+// tagPattern matches a tag
+var tagPattern = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+
+// Reference is a parsed image reference, such as ghcr.io/org/app:1.0@sha256:...
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference splits an image reference into its registry host (with any port), repository path,
+// tag and digest. Docker Hub is assumed when no registry is given, with official images under library/,
+// and the tag defaults to latest when there is neither a tag nor a digest.
+func ParseReference(image string) (Reference, error) {
+	var ref Reference
+
+	name := strings.TrimSpace(image)
+	if name == "" {
+		return ref, fmt.Errorf("image reference cannot be empty")
+	}
+
+	if before, digest, ok := strings.Cut(name, "@"); ok {
+		if !digestPattern.MatchString(digest) {
+			return ref, fmt.Errorf("invalid digest in image reference %s", image)
+		}
+
+		name, ref.Digest = before, digest
+	}
+
+	// the tag follows the last colon after the last slash, so registry ports are not mistaken for tags
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+	}
+
+	ref.Registry, ref.Repository = splitRegistry(name)
+
+	if ref.Registry == DockerHub && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+
+	if !repositoryPattern.MatchString(ref.Repository) {
+		return ref, fmt.Errorf("invalid repository name in image reference %s", image)
+	}
+
+	if ref.Tag != "" && !tagPattern.MatchString(ref.Tag) {
+		return ref, fmt.Errorf("invalid tag in image reference %s", image)
+	}
+
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+
+	return ref, nil
+}
+
+// splitRegistry separates the registry host from the repository path. The first component is a
+// registry host only if it looks like one: it has a dot or a port, or is localhost.
+func splitRegistry(name string) (string, string) {
+	host, path, ok := strings.Cut(name, "/")
+	if !ok || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return DockerHub, name
+	}
+
+	if host == "index.docker.io" || host == dockerHubAPI {
+		host = DockerHub
+	}
+
+	return host, path
+}
+
+// APIHost returns the host that serves the registry API
+func (r Reference) APIHost() string {
+	if r.Registry == DockerHub {
+		return dockerHubAPI
+	}
+
+	return r.Registry
+}
+
+// Identifier returns the digest when the reference has one, and the tag otherwise
+func (r Reference) Identifier() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+
+	return r.Tag
+}
+
+// Name returns the registry and repository, without tag or digest
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// String returns the full reference
+func (r Reference) String() string {
+	name := r.Name()
+	if r.Tag != "" {
+		name += ":" + r.Tag
+	}
+
+	if r.Digest != "" {
+		name += "@" + r.Digest
+	}
+
+	return name
+}
@@ -0,0 +1,47 @@
+package registry
+
+import (
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	t.Parallel()
+
+	digest := "sha256:4bcff63911fcb4448bd4fdacec207030997caf25e9bea4045fa6c8c44de311d1"
+
+	tests := []struct {
+		name    string
+		image   string
+		want    Reference
+		wantErr bool
+	}{
+		{"official", "alpine", Reference{DockerHub, "library/alpine", "latest", ""}, false},
+		{"hub user", "jameswoolfenden/ghat:1.0", Reference{DockerHub, "jameswoolfenden/ghat", "1.0", ""}, false},
+		{"explicit hub", "docker.io/library/node:18-alpine", Reference{DockerHub, "library/node", "18-alpine", ""}, false},
+		{"ghcr", "ghcr.io/org/team/app:v2", Reference{"ghcr.io", "org/team/app", "v2", ""}, false},
+		{"port", "harbor.internal:5000/base/python", Reference{"harbor.internal:5000", "base/python", "latest", ""}, false},
+		{"localhost", "localhost/app:dev", Reference{"localhost", "app", "dev", ""}, false},
+		{"digest", "node@" + digest, Reference{DockerHub, "library/node", "", digest}, false},
+		{"tag and digest", "quay.io/org/app:1@" + digest, Reference{"quay.io", "org/app", "1", digest}, false},
+		{"empty", "", Reference{}, true},
+		{"bad digest", "alpine@sha256", Reference{}, true},
+		{"upper case", "Alpine", Reference{}, true},
+		{"bad tag", "alpine:..", Reference{}, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseReference(tt.image)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseReference() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseReference() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
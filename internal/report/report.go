@@ -0,0 +1,70 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/jameswoolfenden/stevedore/internal/dockerfile"
+)
+
+// Report formats
+const (
+	FormatJSON  = "json"
+	FormatSARIF = "sarif"
+)
+
+// Document is the JSON report of a run, with one entry per Dockerfile
+type Document struct {
+	Tool    string                  `json:"tool"`
+	Version string                  `json:"version"`
+	Command string                  `json:"command"`
+	Files   []dockerfile.FileReport `json:"files"`
+}
+
+// Format picks the report format, from the format flag when one is given and otherwise from the
+// extension of the report file
+func Format(format, path string) (string, error) {
+	if format == "" {
+		if strings.EqualFold(filepath.Ext(path), ".sarif") {
+			return FormatSARIF, nil
+		}
+
+		return FormatJSON, nil
+	}
+
+	switch format = strings.ToLower(format); format {
+	case FormatJSON, FormatSARIF:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown report format %q, expected json or sarif", format)
+	}
+}
+
+// WriteJSON writes the report of a run as indented JSON
+func WriteJSON(out io.Writer, version, command string, files []dockerfile.FileReport) error {
+	if files == nil {
+		files = []dockerfile.FileReport{}
+	}
+
+	return encode(out, Document{
+		Tool:    "stevedore",
+		Version: version,
+		Command: command,
+		Files:   files,
+	})
+}
+
+// encode writes a value as indented JSON
+func encode(out io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	return nil
+}
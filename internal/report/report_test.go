@@ -0,0 +1,92 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/jameswoolfenden/stevedore/internal/dockerfile"
+)
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		format  string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"json by default", "", "report.json", FormatJSON, false},
+		{"sarif by extension", "", "results.SARIF", FormatSARIF, false},
+		{"flag wins", "json", "results.sarif", FormatJSON, false},
+		{"stdout", "sarif", "-", FormatSARIF, false},
+		{"unknown", "xml", "report.xml", "", true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := Format(tt.format, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Format() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	t.Parallel()
+
+	files := []dockerfile.FileReport{
+		{
+			Path: "services/api/Dockerfile",
+			Findings: []dockerfile.Finding{
+				{Path: "services/api/Dockerfile", Stage: "0", Line: 1, Key: "layer.0.author", Kind: dockerfile.FindingMissing},
+				{Path: "services/api/Dockerfile", Stage: "0", Line: 3, Key: "git_commit", Kind: dockerfile.FindingStale, Got: "a", Want: "b"},
+			},
+		},
+		{Path: "services/web/Dockerfile", Error: "no FROM instruction found"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, "1.0.0", files); err != nil {
+		t.Fatalf("WriteSARIF() error = %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("WriteSARIF() wrote invalid JSON: %v", err)
+	}
+
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("WriteSARIF() version %q with %d runs, want 2.1.0 with 1", log.Version, len(log.Runs))
+	}
+
+	run := log.Runs[0]
+
+	if len(run.Results) != 2 {
+		t.Fatalf("WriteSARIF() wrote %d results, want 2", len(run.Results))
+	}
+
+	stale := run.Results[1]
+	if stale.RuleID != "stale-label" || stale.Level != "warning" {
+		t.Errorf("WriteSARIF() stale result = %s/%s, want stale-label/warning", stale.RuleID, stale.Level)
+	}
+
+	location := stale.Locations[0].PhysicalLocation
+	if location.ArtifactLocation.URI != "services/api/Dockerfile" || location.Region == nil || location.Region.StartLine != 3 {
+		t.Errorf("WriteSARIF() stale location = %+v, want services/api/Dockerfile line 3", location)
+	}
+
+	invocation := run.Invocations[0]
+	if invocation.ExecutionSuccessful || len(invocation.ToolExecutionNotifications) != 1 {
+		t.Errorf("WriteSARIF() invocation = %+v, want the failed file reported", invocation)
+	}
+}
@@ -0,0 +1,183 @@
+package report
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/jameswoolfenden/stevedore/internal/dockerfile"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	toolURI      = "https://github.com/JamesWoolfenden/stevedore"
+)
+
+// sarifRules describes the rule each kind of check finding reports against
+var sarifRules = []sarifRule{
+	{
+		ID:               "missing-label",
+		Name:             "MissingLabel",
+		ShortDescription: sarifMessage{Text: "A required label is missing or empty"},
+		DefaultConfiguration: sarifConfiguration{
+			Level: "error",
+		},
+	},
+	{
+		ID:               "stale-label",
+		Name:             "StaleLabel",
+		ShortDescription: sarifMessage{Text: "A label no longer matches what stevedore would write"},
+		DefaultConfiguration: sarifConfiguration{
+			Level: "warning",
+		},
+	},
+}
+
+// sarifLog is the subset of a SARIF 2.1.0 log that stevedore writes
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// WriteSARIF writes the check findings as a SARIF log, so code scanning can annotate the lines
+// that need labels. Files that could not be checked are reported as tool notifications.
+func WriteSARIF(out io.Writer, version string, files []dockerfile.FileReport) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "stevedore",
+			Version:        version,
+			InformationURI: toolURI,
+			Rules:          sarifRules,
+		}},
+		Invocations: []sarifInvocation{{ExecutionSuccessful: true}},
+		Results:     []sarifResult{},
+	}
+
+	for _, file := range files {
+		if file.Error != "" {
+			run.Invocations[0].ExecutionSuccessful = false
+			run.Invocations[0].ToolExecutionNotifications = append(run.Invocations[0].ToolExecutionNotifications,
+				sarifNotification{
+					Level:     "error",
+					Message:   sarifMessage{Text: file.Error},
+					Locations: []sarifLocation{location(file.Path, 0)},
+				})
+		}
+
+		for _, finding := range file.Findings {
+			run.Results = append(run.Results, result(finding))
+		}
+	}
+
+	return encode(out, sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	})
+}
+
+// result converts a check finding into a SARIF result
+func result(finding dockerfile.Finding) sarifResult {
+	rule := sarifRules[0]
+	if finding.Kind == dockerfile.FindingStale {
+		rule = sarifRules[1]
+	}
+
+	return sarifResult{
+		RuleID:    rule.ID,
+		Level:     rule.DefaultConfiguration.Level,
+		Message:   sarifMessage{Text: finding.String()},
+		Locations: []sarifLocation{location(finding.Path, finding.Line)},
+	}
+}
+
+// location points at a line of a file, by a path relative to the working directory where it can
+// be, since code scanning resolves locations against the repository root
+func location(path string, line int) sarifLocation {
+	if filepath.IsAbs(path) {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, path); err == nil {
+				path = rel
+			}
+		}
+	}
+
+	physical := sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(filepath.Clean(path))},
+	}
+
+	if line > 0 {
+		physical.Region = &sarifRegion{StartLine: line}
+	}
+
+	return sarifLocation{PhysicalLocation: physical}
+}
@@ -127,7 +127,7 @@ func TestDockerfile_GetDockerLabels(t *testing.T) {
 		wantErr bool
 	}{
 		{"Pass", fields{nil, "", "jameswoolfenden/ghat"}, pass, false},
-		// Note: Newer Docker manifests don't have v1Compatibility history, so these return nil
+		// Note: labels now come from the image config blob, so these images return nil only if they have none
 		{"Fail", fields{nil, "", "jameswoolfenden/guff"}, nil, false},
 		{"library", fields{nil, "", "alpine"}, nil, false},
 	}
@@ -146,9 +146,9 @@ func TestDockerfile_GetDockerLabels(t *testing.T) {
 				t.Errorf("GetDockerLabels() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			// Allow nil or empty map as equivalent for modern manifests without history
+			// Allow nil or empty map as equivalent for images without labels
 			if tt.want == nil && len(got) == 0 {
-				return // This is expected for modern Docker manifests
+				return
 			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("GetDockerLabels() got = %v, want %v", got, tt.want)